@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The address to serve the API on, such as ":8082". The API is not served
+// when unset.
+const ENV_API_ADDR = "FRAMMIEBOT_API_ADDR"
+
+// The secret clients must send as bearer token to control betting rounds
+// through the API.
+const ENV_API_TOKEN = "FRAMMIEBOT_API_TOKEN"
+
+// The betting commands that can be run through the API.
+var apiActions = map[string]bool{"start": true, "close": true, "reopen": true, "end": true, "clear": true}
+
+// The secret of the API, resolved on startup.
+var apiToken string
+
+// The responses to commands run through the API, captured by respond rather
+// than sent to chat, per message of the running command.
+var apiReplies = struct {
+	sync.Mutex
+	replies map[*twitch.PrivateMessage][]string
+}{replies: make(map[*twitch.PrivateMessage][]string)}
+
+// Captures given response to given message if the message was run through
+// the API. Returns false if the response should be sent to chat instead.
+func captureReply(message *twitch.PrivateMessage, response string) bool {
+	apiReplies.Lock()
+	defer apiReplies.Unlock()
+	replies, exist := apiReplies.replies[message]
+	if !exist { return false }
+	apiReplies.replies[message] = append(replies, response)
+	return true
+}
+
+// The state of a betting round as reported by the API. Bets are left out,
+// as they may have been placed privately.
+type apiRound struct {
+	Channel string `json:"channel"`
+	Name string `json:"name,omitempty"`
+	Kind string `json:"kind"`
+	Mode string `json:"mode"`
+	Closed bool `json:"closed"`
+	Locked bool `json:"locked"`
+	Participants int `json:"participants"`
+}
+
+// Writes given value as JSON with given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Writes a JSON error with given status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Serves /channels/<channel>/round, reporting the round named by the name
+// query parameter, and /channels/<channel>/round/<action>, running the bet
+// subcommand of the action with the arguments in the body, such as
+// {"args": ["12:00", "+/-5"]}.
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != "channels" || parts[2] != "round" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	channel := normalizeChannel(parts[1])
+	if !isJoined(channel) {
+		writeError(w, http.StatusNotFound, "not in channel " + channel)
+		return
+	}
+	name := r.URL.Query().Get("name")
+
+	if len(parts) == 3 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		apiGetRound(w, channel, name)
+		return
+	}
+
+	action := parts[3]
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !apiAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if !apiActions[action] {
+		writeError(w, http.StatusNotFound, "unknown action " + action)
+		return
+	}
+	var body struct {
+		Args []string `json:"args"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid body: " + err.Error())
+			return
+		}
+	}
+	if action != "start" && getRound(channel, name) == nil && (name != "" || len(roundNames(channel)) == 0) {
+		writeError(w, http.StatusNotFound, "no active round")
+		return
+	}
+	args := append([]string{action}, body.Args...)
+	if name != "" {
+		args = append(args, name)
+	}
+	previous := lastResult(channel)
+	response := struct {
+		Replies []string `json:"replies"`
+		// The outcome of the round, if the action ended it.
+		Result *RoundResult `json:"result,omitempty"`
+	}{Replies: apiRun(channel, args)}
+	if result := lastResult(channel); result != previous {
+		response.Result = result
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Reports the round of given name on given channel.
+func apiGetRound(w http.ResponseWriter, channel string, name string) {
+	round := getRound(channel, name)
+	if round == nil && name == "" {
+		if names := roundNames(channel); len(names) == 1 {
+			round = getRound(channel, names[0])
+		}
+	}
+	if round == nil {
+		writeError(w, http.StatusNotFound, "no active round")
+		return
+	}
+	round.Lock()
+	state := apiRound{
+		Channel: channel,
+		Name: round.name,
+		Kind: round.kind.name,
+		Mode: round.mode,
+		Closed: round.closed,
+		Locked: round.locked,
+		Participants: len(round.bets),
+	}
+	round.Unlock()
+	writeJSON(w, http.StatusOK, state)
+}
+
+// Whether the request carries the secret of the API.
+func apiAuthorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && apiToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1
+}
+
+// Runs the bet command with given arguments on given channel as the
+// broadcaster, returning the responses it gave.
+func apiRun(channel string, args []string) []string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	message := &twitch.PrivateMessage{
+		User: twitch.User{Name: "api", DisplayName: "API", Badges: map[string]int{"broadcaster": 1}},
+		Channel: channel,
+		Message: prefixOf(channel) + "bet " + strings.Join(args, " "),
+		Time: time.Now(),
+	}
+	apiReplies.Lock()
+	apiReplies.replies[message] = []string{}
+	apiReplies.Unlock()
+
+	slog.Info("Running API command", "event", "api", "channel", channel, "command", args[0])
+	runCommand(betCommands, message, args, "bet")
+
+	apiReplies.Lock()
+	defer apiReplies.Unlock()
+	replies := apiReplies.replies[message]
+	delete(apiReplies.replies, message)
+	return replies
+}
+
+// Serves the API on given address in the background. Returns the server so
+// it can be shut down.
+func serveAPI(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/channels/", apiHandler)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		slog.Info("Serving API", "event", "api", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Failed to serve API", "event", "api", "addr", addr, "error", err)
+		}
+	}()
+	return server
+}
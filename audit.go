@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// The path of the file every bet and round outcome is appended to. No audit
+// log is kept when unset.
+const ENV_AUDIT_FILE = "FRAMMIEBOT_AUDIT_FILE"
+
+// The size beyond which the audit log is moved aside and a new one started.
+const MAX_AUDIT_SIZE = 10 * 1024 * 1024
+
+// An AuditEntry is a single line of the audit log.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	Event string `json:"event"`
+	Channel string `json:"channel"`
+	Round string `json:"round,omitempty"`
+	User string `json:"user,omitempty"`
+	Times []string `json:"times,omitempty"`
+	Results []string `json:"results,omitempty"`
+	Winners []string `json:"winners,omitempty"`
+	// The user affected by the event, if not the user causing it.
+	Target string `json:"target,omitempty"`
+	// The points wagered, given or paid out.
+	Amount int64 `json:"amount,omitempty"`
+}
+
+// The open audit log. Writes are serialized so concurrent entries never
+// interleave.
+var auditLog = struct {
+	sync.Mutex
+	path string
+	file *os.File
+	size int64
+}{}
+
+// Opens the audit log at given path for appending.
+func openAudit(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	auditLog.path, auditLog.file, auditLog.size = path, file, info.Size()
+	return nil
+}
+
+// Closes the audit log, if open.
+func closeAudit() {
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	if auditLog.file != nil {
+		auditLog.file.Close()
+		auditLog.file = nil
+	}
+}
+
+// Appends given entry to the audit log, if open. Once the log grows beyond
+// its maximum size it is renamed with a timestamp suffix, so no entries are
+// ever overwritten.
+func audit(entry AuditEntry) {
+	entry.Time = time.Now()
+	line, err := json.Marshal(&entry)
+	if err != nil {
+		slog.Error("Failed to encode audit entry", "event", "audit", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	if auditLog.file == nil { return }
+	if auditLog.size + int64(len(line)) > MAX_AUDIT_SIZE && auditLog.size > 0 {
+		rotateAudit()
+	}
+	n, err := auditLog.file.Write(line)
+	auditLog.size += int64(n)
+	if err != nil {
+		slog.Error("Failed to write audit log", "event", "audit", "file", auditLog.path, "error", err)
+	}
+}
+
+// Moves the full audit log aside and starts a new one. The caller must hold
+// the audit log mutex.
+func rotateAudit() {
+	rotated := auditLog.path + "." + time.Now().Format("20060102-150405")
+	auditLog.file.Close()
+	if err := os.Rename(auditLog.path, rotated); err != nil {
+		slog.Error("Failed to rotate audit log", "event", "audit", "file", auditLog.path, "error", err)
+	}
+	file, err := os.OpenFile(auditLog.path, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644)
+	if err != nil {
+		slog.Error("Failed to open audit log", "event", "audit", "file", auditLog.path, "error", err)
+		auditLog.file = nil
+		return
+	}
+	auditLog.file, auditLog.size = file, 0
+}
+
+// Formats given guesses for the audit log.
+func guessStrings(guesses []Guess) []string {
+	s := make([]string, len(guesses))
+	for i, guess := range guesses {
+		s[i] = guess.String()
+	}
+	return s
+}
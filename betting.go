@@ -0,0 +1,1255 @@
+package main
+
+import (
+	"errors"
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The ways in which the winners of a betting round can be determined.
+const (
+	// Only users whose bet matches every result win.
+	MODE_EXACT = "exact"
+	// The users whose bet is closest to the results win.
+	MODE_CLOSEST = "closest"
+	// The users whose bet matches the most results win.
+	MODE_PARTIAL = "partial"
+)
+
+// Prefix of the optional tolerance argument of starting or ending a round,
+// in minutes for rounds of times and in seconds for rounds of durations.
+const TOLERANCE_PREFIX = "+/-"
+
+// The rules for breaking a tie between multiple winners of a round.
+const (
+	// All tied users win.
+	TIEBREAK_ALL = "all"
+	// The tied user whose bet was placed first wins.
+	TIEBREAK_EARLIEST = "earliest"
+	// The tied user whose bet was placed last wins.
+	TIEBREAK_LATEST = "latest"
+)
+
+// The arguments understood when starting a betting round.
+const START_USAGE = "[name] [time|number|duration|" + OPTIONS_ARG + " <option...>] [" + MODE_EXACT + "|" + MODE_CLOSEST + "|" + MODE_PARTIAL + "] [lock] [duration] [" + REMINDER_PREFIX + "interval] [" + TIEBREAK_PREFIX + TIEBREAK_ALL + "|" + TIEBREAK_EARLIEST + "|" + TIEBREAK_LATEST + "] [" + MIN_PREFIX + "participants] [" + GRACE_PREFIX + "duration] [" + TOLERANCE_PREFIX + "n]"
+
+// The start argument followed by the options of a round betting on one of
+// them.
+const OPTIONS_ARG = "options"
+
+// Prefix of the start argument setting the minimum number of participants.
+const MIN_PREFIX = "min="
+
+// Prefix of the start argument setting how long after closing bets are
+// still accepted.
+const GRACE_PREFIX = "grace="
+
+// The length beyond which the count command stops listing participants.
+const MAX_COUNT_LENGTH = 400
+
+// The number of guesses shown by the odds command.
+const ODDS_SIZE = 5
+
+// The argument ending a round regardless of its minimum number of
+// participants.
+const FORCE_ARG = "force"
+
+// The maximum number of values in a single bet when none is configured.
+const DEFAULT_MAX_SLOTS = 10
+
+// Prefix of the start argument setting the interval of reminders.
+const REMINDER_PREFIX = "reminder="
+
+// Prefix of the start argument setting the tie-break rule.
+const TIEBREAK_PREFIX = "tiebreak="
+
+// The pattern names of betting rounds must match. Names must start with a
+// letter so they can not be mistaken for the values bet on.
+var roundNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// The shortest interval reminders may be posted at.
+const MIN_REMINDER_INTERVAL = 30 * time.Second
+
+// RoundOptions are the settings a betting round is started with.
+type RoundOptions struct {
+	// The kind of values bet on.
+	kind *Kind
+	mode string
+	// Whether bets are final once placed.
+	locked bool
+	// Close the round automatically after this duration, if non-zero.
+	autoClose time.Duration
+	// Remind chat of the open round at this interval, if non-zero.
+	reminder time.Duration
+	// How a tie between multiple winners is broken.
+	tieBreak string
+	// The number of users that must have bet before winners are declared.
+	minParticipants int
+	// How long after closing bets sent before then are still accepted.
+	grace time.Duration
+	// The tolerance used when the round is ended without one, in units of
+	// tolerance of the kind.
+	tolerance int
+}
+
+// Reads the name and options of a betting round on given channel from the
+// arguments of the start command. Options not given are the defaults of the
+// channel. The name is empty for the unnamed round.
+func parseRoundOptions(channel string, args []string) (string, RoundOptions, bool) {
+	name := ""
+	options := defaultRoundOptions(channel)
+	modeGiven := false
+	for i, arg := range args {
+		if kind := findKind(arg); kind != nil {
+			options.kind = kind
+		} else if arg == OPTIONS_ARG {
+			// The options take up the remaining arguments.
+			choices, ok := parseOptions(args[i+1:])
+			if !ok || (modeGiven && options.mode == MODE_CLOSEST) {
+				return name, options, false
+			}
+			// Options have no distance, so a channel defaulting to closest
+			// bets on them exactly.
+			if options.mode == MODE_CLOSEST {
+				options.mode = MODE_EXACT
+			}
+			options.kind = optionKind(choices)
+			break
+		} else if arg == MODE_EXACT || arg == MODE_CLOSEST || arg == MODE_PARTIAL {
+			options.mode = arg
+			modeGiven = true
+		} else if arg == "lock" {
+			options.locked = true
+		} else if strings.HasPrefix(arg, REMINDER_PREFIX) {
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, REMINDER_PREFIX))
+			if err != nil || d < MIN_REMINDER_INTERVAL {
+				return name, options, false
+			}
+			options.reminder = d
+		} else if strings.HasPrefix(arg, TIEBREAK_PREFIX) {
+			switch rule := strings.TrimPrefix(arg, TIEBREAK_PREFIX); rule {
+				case TIEBREAK_ALL, TIEBREAK_EARLIEST, TIEBREAK_LATEST:
+					options.tieBreak = rule
+				default:
+					return name, options, false
+			}
+		} else if strings.HasPrefix(arg, GRACE_PREFIX) {
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, GRACE_PREFIX))
+			if err != nil || d < 0 {
+				return name, options, false
+			}
+			options.grace = d
+		} else if strings.HasPrefix(arg, TOLERANCE_PREFIX) {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, TOLERANCE_PREFIX))
+			if err != nil || n < 0 {
+				return name, options, false
+			}
+			options.tolerance = n
+		} else if strings.HasPrefix(arg, MIN_PREFIX) {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, MIN_PREFIX))
+			if err != nil || n < 0 {
+				return name, options, false
+			}
+			options.minParticipants = n
+		} else if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+			options.autoClose = d
+		} else if name == "" && roundNameRegex.MatchString(arg) {
+			name = arg
+		} else {
+			return name, options, false
+		}
+	}
+	return name, options, true
+}
+
+// Returns the options of rounds started on given channel without giving
+// any, as configured for the channel.
+func defaultRoundOptions(channel string) RoundOptions {
+	options := RoundOptions{kind: kinds[0], mode: MODE_EXACT, tieBreak: TIEBREAK_ALL}
+	defaults, exist := config.RoundDefaults[channel]
+	if !exist { return options }
+	if kind := findKind(defaults.Kind); kind != nil {
+		options.kind = kind
+	}
+	if defaults.Mode != "" {
+		options.mode = defaults.Mode
+	}
+	options.tolerance = defaults.Tolerance
+	return options
+}
+
+// Reads the options of a round betting on one of them. There must be at
+// least two distinct options, none of which may be mistaken for a
+// subcommand.
+func parseOptions(args []string) ([]string, bool) {
+	if len(args) < 2 { return nil, false }
+	options := make([]string, len(args))
+	seen := make(map[string]bool, len(args))
+	bet := findCommand(commands, "bet")
+	for i, arg := range args {
+		option := strings.ToLower(arg)
+		if seen[option] || findCommand(bet.subcommands, option) != nil {
+			return nil, false
+		}
+		seen[option] = true
+		options[i] = option
+	}
+	return options, true
+}
+
+// A Bet is the bet of a single user in a betting round.
+type Bet struct {
+	// The values bet on, one per result.
+	times []Guess
+	// When the bet was placed, or last changed.
+	placed time.Time
+	// Whether the bet was placed during the grace period after closing.
+	late bool
+	// The points wagered on the bet.
+	wager int64
+}
+
+// A BettingRound is a single round of betting on a channel. Multiple users
+// may bet at the same time, so the round must be locked before use.
+type BettingRound struct {
+	sync.Mutex
+	RoundOptions
+	// The channel the round is on and its name on that channel, empty for
+	// the unnamed round. Never change, so may be read without locking.
+	channel string
+	name string
+	closed bool
+	// When the round was started.
+	started time.Time
+	// When the round was last closed.
+	closedAt time.Time
+	bets map[string]*Bet
+	// Pending automatic close of the round, if any.
+	timer *time.Timer
+	// Closed to stop posting reminders, if any.
+	stopReminder chan struct{}
+}
+
+// Cancels the pending automatic close and reminders of the round. Round
+// must be locked by the caller.
+func (round *BettingRound) stopTimers() {
+	if round.timer != nil {
+		round.timer.Stop()
+		round.timer = nil
+	}
+	if round.stopReminder != nil {
+		close(round.stopReminder)
+		round.stopReminder = nil
+	}
+}
+
+// Starts posting reminders on the channel of the round, if the round has a
+// reminder interval. Round must be locked by the caller, unless not yet
+// shared.
+func (round *BettingRound) startReminder() {
+	if round.reminder > 0 && round.stopReminder == nil {
+		round.stopReminder = make(chan struct{})
+		go remind(round.channel, round.name, round.reminder, round.stopReminder)
+	}
+}
+
+// Closes the round after given duration, announcing it has. Round must be
+// locked by the caller.
+func (round *BettingRound) startAutoClose(after time.Duration) {
+	round.timer = time.AfterFunc(after, func() {
+		round.Lock()
+		round.timer = nil
+		wasOpen := round.close(time.Now())
+		count := len(round.bets)
+		round.Unlock()
+		if !wasOpen { return }
+		saveState()
+		configLock.RLock()
+		announcement := TIME_UP_RESPONSE.format("{round}", onRound(round.name), "{locked}", lockedIn(count))
+		configLock.RUnlock()
+		chat.Say(round.channel, announcement)
+	})
+}
+
+// Closes the round at given time and cancels its pending automatic close
+// and reminders. Bets sent after that time are refused, even when they are
+// handled before the round was closed. Returns whether the round was still
+// open. Round must be locked by the caller.
+func (round *BettingRound) close(at time.Time) bool {
+	round.stopTimers()
+	wasOpen := !round.closed
+	if wasOpen {
+		round.closedAt = at
+	}
+	round.closed = true
+	return wasOpen
+}
+
+// Describes the round of given name in messages, as in "Betting on name has
+// started". Empty for the unnamed round.
+func onRound(name string) string {
+	if name == "" { return "" }
+	return " on " + name
+}
+
+// The currently open betting rounds per channel by name, the unnamed round
+// having an empty name. Message handlers may be dispatched concurrently, so
+// the rounds map is guarded by a mutex. To avoid deadlocks, a round must
+// never be locked while holding this mutex.
+var channelBets = struct {
+	sync.RWMutex
+	rounds map[string]map[string]*BettingRound
+}{rounds: make(map[string]map[string]*BettingRound)}
+
+// Returns the betting round of given name currently open on given channel,
+// or nil if there is none.
+func getRound(channel string, name string) *BettingRound {
+	channelBets.RLock()
+	defer channelBets.RUnlock()
+	return channelBets.rounds[channel][name]
+}
+
+// Returns the names of the betting rounds currently open on given channel,
+// sorted.
+func roundNames(channel string) []string {
+	channelBets.RLock()
+	defer channelBets.RUnlock()
+	names := make([]string, 0, len(channelBets.rounds[channel]))
+	for name := range channelBets.rounds[channel] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns a snapshot of the betting rounds of all channels.
+func allRounds() []*BettingRound {
+	channelBets.RLock()
+	defer channelBets.RUnlock()
+	rounds := make([]*BettingRound, 0, len(channelBets.rounds))
+	for _, named := range channelBets.rounds {
+		for _, round := range named {
+			rounds = append(rounds, round)
+		}
+	}
+	return rounds
+}
+
+// Adds given round to the open rounds, returning the round of the same
+// name it replaces, if any. The caller must hold the channelBets mutex.
+func addRound(round *BettingRound) *BettingRound {
+	named := channelBets.rounds[round.channel]
+	if named == nil {
+		named = make(map[string]*BettingRound)
+		channelBets.rounds[round.channel] = named
+	}
+	previous := named[round.name]
+	named[round.name] = round
+	return previous
+}
+
+// Replaces the betting round of given name on given channel with a new,
+// empty round using given options.
+func startRound(channel string, name string, options RoundOptions) *BettingRound {
+	round := &BettingRound{RoundOptions: options, channel: channel, name: name, started: time.Now(), bets: make(map[string]*Bet)}
+	if options.autoClose > 0 {
+		// Hold the lock so the timer can not fire before it is stored.
+		round.Lock()
+		round.startAutoClose(options.autoClose)
+		round.Unlock()
+	}
+	round.startReminder()
+
+	channelBets.Lock()
+	previous := addRound(round)
+	channelBets.Unlock()
+
+	if previous != nil {
+		previous.Lock()
+		previous.close(time.Now())
+		refundWagers(channel, previous.bets)
+		previous.Unlock()
+	}
+	return round
+}
+
+// Posts a reminder of the open betting round of given name on given channel
+// at given interval, until stopped.
+func remind(channel string, name string, interval time.Duration, stop chan struct{}) {
+	configLock.RLock()
+	usage := prefixOf(channel) + "bet <value...>"
+	configLock.RUnlock()
+	if name != "" {
+		usage += " " + name
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+			case <-ticker.C:
+				configLock.RLock()
+				reminder := REMINDER_RESPONSE.format("{round}", onRound(name), "{usage}", usage)
+				configLock.RUnlock()
+				chat.Say(channel, reminder)
+			case <-stop:
+				return
+		}
+	}
+}
+
+// Cancels the pending automatic close and reminders of every betting round.
+func stopTimers() {
+	for _, round := range allRounds() {
+		round.Lock()
+		round.stopTimers()
+		round.Unlock()
+	}
+}
+
+// How often rounds are checked for having expired.
+const EXPIRY_INTERVAL = time.Minute
+
+// Periodically removes the rounds that have expired. Runs until the bot
+// stops.
+func expireRounds() {
+	for range time.Tick(EXPIRY_INTERVAL) {
+		expireOldRounds()
+	}
+}
+
+// Removes the rounds started longer ago than the configured maximum age,
+// refunding their wagers.
+func expireOldRounds() {
+	configLock.RLock()
+	maxAge, announce := config.MaxRoundAge.Duration, config.AnnounceExpiry
+	configLock.RUnlock()
+	if maxAge <= 0 { return }
+
+	expired := false
+	for _, round := range allRounds() {
+		round.Lock()
+		old := time.Since(round.started) > maxAge
+		round.Unlock()
+		// A round replaced in the meantime is left to its successor.
+		if !old || !takeThisRound(round) { continue }
+
+		round.Lock()
+		round.close(time.Now())
+		refundWagers(round.channel, round.bets)
+		participants := len(round.bets)
+		round.Unlock()
+		expired = true
+		slog.Info("Round expired", "event", "expire", "channel", round.channel, "round", round.name, "participants", participants)
+		audit(AuditEntry{Event: "expire", Channel: round.channel, Round: round.name})
+		if announce {
+			configLock.RLock()
+			announcement := EXPIRED_RESPONSE.format("{round}", onRound(round.name))
+			configLock.RUnlock()
+			chat.Say(round.channel, announcement)
+		}
+	}
+	if expired {
+		saveState()
+	}
+}
+
+// Removes given round from the open rounds, unless it has already been
+// removed or replaced. Returns whether the round was removed.
+func takeThisRound(round *BettingRound) bool {
+	channelBets.Lock()
+	defer channelBets.Unlock()
+	if channelBets.rounds[round.channel][round.name] != round { return false }
+	delete(channelBets.rounds[round.channel], round.name)
+	if len(channelBets.rounds[round.channel]) == 0 {
+		delete(channelBets.rounds, round.channel)
+	}
+	return true
+}
+
+// Removes and returns the betting round of given name on given channel, or
+// nil if there is none. Only one caller can ever take a given round.
+func takeRound(channel string, name string) *BettingRound {
+	channelBets.Lock()
+	defer channelBets.Unlock()
+	round := channelBets.rounds[channel][name]
+	delete(channelBets.rounds[channel], name)
+	if len(channelBets.rounds[channel]) == 0 {
+		delete(channelBets.rounds, channel)
+	}
+	return round
+}
+
+// Converts given input array of strings to array of Guess of given kind, or
+// if failed, notify the requester which value could not be read and why and
+// return error. If values were given in differing precisions, the requester
+// is told how they were understood.
+func formatTimes(kind *Kind, times []string, message *twitch.PrivateMessage) ([]Guess, error) {
+	ft, err := parseGuesses(kind, times)
+	if err != nil {
+		respondError(message, err)
+		return nil, err
+	}
+	for _, pt := range ft {
+		if pt.precision != ft[0].precision {
+			respond(message, "Understood your " + kind.noun + " as " + joinGuesses(ft) + ".")
+			break
+		}
+	}
+	return ft, nil
+}
+
+// Reads given values as guesses of given kind. Returns a ValueError for the
+// first value that is not of the kind.
+func parseGuesses(kind *Kind, values []string) ([]Guess, error) {
+	guesses := make([]Guess, len(values))
+	for i, value := range values {
+		guess, err := kind.parse(value)
+		if err != nil {
+			return nil, &ValueError{value, kind, err}
+		}
+		guesses[i] = guess
+	}
+	return guesses, nil
+}
+
+// Whether given guesses are the same values in the same order, given in the
+// same precision.
+func equalGuesses(a []Guess, b []Guess) bool {
+	if len(a) != len(b) { return false }
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the number of given results matched by given bet, a value within
+// tolerance of its result being considered a match.
+func matches(times []Guess, results []Guess, tolerance int64) int {
+	n := 0
+	for i := 0; i < len(results) && i < len(times); i++ {
+		if distance(times[i], results[i]) <= tolerance {
+			n++
+		}
+	}
+	return n
+}
+
+// Determines the winners of given round for given results according to the
+// mode and tie-break rule of the round. In exact and partial mode, a bet
+// within tolerance of a result is considered a match. The values of a bet
+// are compared to the results in order. Values beyond the last result are
+// ignored, so they neither count nor disqualify, while results beyond the
+// last value of a bet are missed. There are no winners without results.
+// Round must be locked by the caller.
+func determineWinners(round *BettingRound, results []Guess, tolerance int64) []string {
+	winners := make([]string, 0, 5)
+	if len(results) == 0 { return winners }
+	switch round.mode {
+		// Users with the smallest total distance to the results win, ties
+		// are all awarded.
+		case MODE_CLOSEST:
+			var best int64 = -1
+			for user, bet := range round.bets {
+				total := score(round, bet.times, results, tolerance)
+				if best < 0 || total < best {
+					best = total
+					winners = winners[:0]
+				}
+				if total == best {
+					winners = append(winners, user)
+				}
+			}
+		// Users matching the most results win, if they match any.
+		case MODE_PARTIAL:
+			best := 1
+			for user, bet := range round.bets {
+				times := bet.times
+				score := matches(times, results, tolerance)
+				if score > best {
+					best = score
+					winners = winners[:0]
+				}
+				if score == best {
+					winners = append(winners, user)
+				}
+			}
+		// Users matching every result exactly win.
+		default:
+			for user, bet := range round.bets {
+				if matches(bet.times, results, tolerance) == len(results) {
+					winners = append(winners, user)
+				}
+			}
+	}
+	return breakTie(round, winners)
+}
+
+// Returns the total distance of given bet to given results, the lower the
+// more accurate. Closest mode counts every result, a penalty standing in
+// for results the bet has no value for. Other modes only count the values
+// matching their result. Round must be locked by the caller.
+func score(round *BettingRound, times []Guess, results []Guess, tolerance int64) int64 {
+	var total int64
+	for i := 0; i < len(results); i++ {
+		if i > len(times)-1 {
+			if round.mode == MODE_CLOSEST {
+				total += round.kind.penalty
+			}
+		} else if d := distance(times[i], results[i]); round.mode == MODE_CLOSEST || d <= tolerance {
+			total += d
+		}
+	}
+	return total
+}
+
+// Orders given winners of given round from most to least accurate, earlier
+// bets going first among equally accurate ones. Returns how accurate each
+// winner was: how many results they matched in partial mode, and how far off
+// they were in closest mode unless distance means nothing for the kind of
+// the round. Winners in exact mode matched everything, so nothing is
+// returned for them. Round must be locked by the caller.
+func rankWinners(round *BettingRound, winners []string, results []Guess, tolerance int64) map[string]string {
+	scores := make(map[string]int64, len(winners))
+	for _, user := range winners {
+		scores[user] = score(round, round.bets[user].times, results, tolerance)
+	}
+	sort.SliceStable(winners, func(i, j int) bool {
+		a, b := winners[i], winners[j]
+		if scores[a] != scores[b] {
+			return scores[a] < scores[b]
+		}
+		if !round.bets[a].placed.Equal(round.bets[b].placed) {
+			return round.bets[a].placed.Before(round.bets[b].placed)
+		}
+		return a < b
+	})
+	details := make(map[string]string, len(winners))
+	if round.mode == MODE_PARTIAL {
+		for _, user := range winners {
+			details[user] = strconv.Itoa(matches(round.bets[user].times, results, tolerance)) + "/" + strconv.Itoa(len(results)) + " matched"
+		}
+		return details
+	}
+	if round.mode != MODE_CLOSEST || round.kind.options != nil { return nil }
+	for user, s := range scores {
+		if s == 0 {
+			details[user] = "spot on"
+		} else {
+			details[user] = "off by " + round.kind.formatDistance(s)
+		}
+	}
+	return details
+}
+
+// Narrows given winners of given round down to a single winner according
+// to the tie-break rule of the round. Round must be locked by the caller.
+func breakTie(round *BettingRound, winners []string) []string {
+	if len(winners) < 2 || round.tieBreak == TIEBREAK_ALL {
+		return winners
+	}
+	best := winners[0]
+	for _, user := range winners[1:] {
+		placed, bestPlaced := round.bets[user].placed, round.bets[best].placed
+		if round.tieBreak == TIEBREAK_EARLIEST && placed.Before(bestPlaced) ||
+			round.tieBreak == TIEBREAK_LATEST && placed.After(bestPlaced) {
+			best = user
+		}
+	}
+	return []string{best}
+}
+
+// Checks if on the channel the message originated from there is currently
+// a bidding round going on, and if so returns it along with the arguments
+// without its name, as selected by findActiveRound. Otherwise the requester
+// is told there is none, or asked which round they meant.
+func checkActiveBidding(message *twitch.PrivateMessage, args []string) (*BettingRound, []string) {
+	round, rest, err := findActiveRound(message.Channel, args)
+	if err != nil {
+		respondError(message, err)
+		return nil, args
+	}
+	return round, rest
+}
+
+// Returns the round on given channel selected by given arguments, along
+// with the arguments without its name. An argument naming an open round
+// selects that round. Otherwise the unnamed round is selected, or the only
+// round open. Returns ErrNoActiveRound if there is no round, or an
+// AmbiguousRoundError if it is unclear which round is meant.
+func findActiveRound(channel string, args []string) (*BettingRound, []string, error) {
+	names := roundNames(channel)
+	if len(names) == 0 {
+		return nil, args, ErrNoActiveRound
+	}
+
+	for i := len(args) - 1; i >= 0; i-- {
+		if args[i] == "" { continue }
+		if round := getRound(channel, args[i]); round != nil {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return round, rest, nil
+		}
+	}
+
+	if round := getRound(channel, ""); round != nil {
+		return round, args, nil
+	} else if len(names) == 1 {
+		if round := getRound(channel, names[0]); round != nil {
+			return round, args, nil
+		}
+	}
+	return nil, args, &AmbiguousRoundError{names}
+}
+
+// The subcommands of the bet command. Any other argument is treated as the
+// times of a bet.
+var betCommands = []*Command{
+	{name: "start", usage: START_USAGE, description: "start a betting round", permission: LEVEL_MOD, handler: betStart},
+	{name: "close", usage: "[round]", description: "close the betting round", permission: LEVEL_MOD, handler: betClose},
+	{name: "reopen", usage: "[round]", description: "reopen a closed betting round", permission: LEVEL_MOD, handler: betReopen},
+	{name: "clear", usage: "[round]", description: "remove all bets, keeping the round", permission: LEVEL_MOD, handler: betClear},
+	{name: "end", usage: "<value...> [" + TOLERANCE_PREFIX + "n] [" + FORCE_ARG + "] [round]", description: "end the round and announce winners", permission: LEVEL_MOD, handler: betEnd},
+	{name: "winners", description: "repeat the winners of the last round", cooldown: true, handler: betWinners},
+	{name: "history", usage: "[n]", description: "show the outcomes of the last rounds", cooldown: true, handler: betHistory},
+	{name: "export", description: "write the results of the last round to a file", permission: LEVEL_MOD, handler: betExport},
+	{name: "status", usage: "[round]", description: "show the state of the round", cooldown: true, handler: betStatus},
+	{name: "count", usage: "[round]", description: "whisper who has bet, without their bets", permission: LEVEL_MOD, handler: betCount},
+	{name: "odds", usage: "[round]", description: "show the most popular guesses", cooldown: true, handler: betOdds},
+	{name: "pot", usage: "[round]", description: "show the points wagered on the round", cooldown: true, handler: betPot},
+	{name: "leaderboard", description: "show the users with the most wins", cooldown: true, handler: betLeaderboard},
+	{name: "stats", usage: "[user]", description: "show lifetime betting statistics", cooldown: true, handler: betStats},
+	{name: "mybet", usage: "[round]", description: "show your current bet", handler: betMine},
+	{name: "cancel", usage: "[round]", description: "retract your bet", handler: betCancel},
+}
+
+// Handles the bet command, dispatching to its subcommands.
+func bet(message *twitch.PrivateMessage, args []string) {
+	// A bare bet is answered with how to bet.
+	if len(args) < 1 || !runCommand(betCommands, message, args, "bet") {
+		placeBet(message, args)
+	}
+}
+
+// Starts a new betting round.
+func betStart(message *twitch.PrivateMessage, args []string) {
+	name, options, ok := parseRoundOptions(message.Channel, args)
+	if !ok {
+		respond(message, "Format: bet start "+START_USAGE)
+		return
+	}
+
+	announcement := "Betting" + onRound(name) + " has started! Place your bets below!"
+	switch options.mode {
+		case MODE_CLOSEST:
+			announcement = "Betting" + onRound(name) + " has started! Closest guess wins, place your bets below!"
+		case MODE_PARTIAL:
+			announcement = "Betting" + onRound(name) + " has started! Most matches wins, place your bets below!"
+	}
+	if name != "" {
+		announcement += " Add " + name + " to your bet."
+	}
+	if options.kind.options != nil {
+		announcement += " Bet on one of " + strings.Join(options.kind.options, ", ") + "."
+	} else if options.kind != kinds[0] {
+		announcement += " Bet on a " + options.kind.name + "."
+	}
+	switch options.tieBreak {
+		case TIEBREAK_EARLIEST:
+			announcement += " Ties go to the earliest bet."
+		case TIEBREAK_LATEST:
+			announcement += " Ties go to the latest bet."
+	}
+	if options.minParticipants > 0 {
+		announcement += " At least " + strconv.Itoa(options.minParticipants) + " participants are needed."
+	}
+	if options.tolerance > 0 && options.mode != MODE_CLOSEST && options.kind.toleranceUnit > 0 {
+		announcement += " Bets off by up to " + options.kind.formatDistance(int64(options.tolerance) * options.kind.toleranceUnit) + " still match."
+	}
+	if options.grace > 0 {
+		announcement += " Bets sent up to " + options.grace.String() + " after closing still count."
+	}
+	if options.locked {
+		announcement += " Bets are final once placed."
+	}
+	if options.autoClose > 0 {
+		announcement += " Betting closes in " + options.autoClose.String() + "."
+	}
+	if options.reminder > 0 {
+		announcement += " I will remind you every " + options.reminder.String() + "."
+	}
+	chat.Say(message.Channel, announcement)
+	startRound(message.Channel, name, options)
+	roundsStartedTotal.Inc("")
+	saveState()
+}
+
+// Closes an existing betting round.
+func betClose(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+	round.Lock()
+	round.close(sentAt(message))
+	count := len(round.bets)
+	round.Unlock()
+	saveState()
+	chat.Say(message.Channel, "Betting" + onRound(round.name) + " has closed! " + lockedIn(count) + " Everyone, good luck!")
+}
+
+// Tells how many bets are final now a round has closed.
+func lockedIn(count int) string {
+	return strconv.Itoa(count) + " bet(s) locked in."
+}
+
+// Reopens a closed betting round, keeping all bets placed.
+func betReopen(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+	if err := round.reopen(); err != nil {
+		respondError(message, err)
+		return
+	}
+	saveState()
+	chat.Say(message.Channel, "Betting" + onRound(round.name) + " has reopened! Place or change your bets below!")
+}
+
+// Reopens the round for bets. Returns ErrNoActiveRound if it has ended in
+// the meantime, or ErrRoundOpen if it is open already.
+func (round *BettingRound) reopen() error {
+	round.Lock()
+	defer round.Unlock()
+	if getRound(round.channel, round.name) != round {
+		return ErrNoActiveRound
+	}
+	if !round.closed {
+		return ErrRoundOpen
+	}
+	round.closed = false
+	round.startReminder()
+	return nil
+}
+
+// Removes all bets of a betting round without ending it.
+func betClear(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+	round.Lock()
+	refundWagers(message.Channel, round.bets)
+	round.bets = make(map[string]*Bet)
+	closed := round.closed
+	round.Unlock()
+	saveState()
+	slog.Info("Bets cleared", "event", "clear", "channel", message.Channel, "round", round.name)
+	audit(AuditEntry{Event: "clear", Channel: message.Channel, Round: round.name, User: message.User.DisplayName})
+	if closed {
+		chat.Say(message.Channel, "Bets" + onRound(round.name) + " cleared.")
+	} else {
+		chat.Say(message.Channel, "Bets" + onRound(round.name) + " cleared, place them again!")
+	}
+}
+
+// Ends a betting round and announces its winners.
+func betEnd(message *twitch.PrivateMessage, args []string) {
+	current, args := checkActiveBidding(message, args)
+	if current == nil { return }
+	kind := current.kind
+
+	// Split off the optional override of the minimum participants
+	force := false
+	if len(args) > 0 && args[len(args)-1] == FORCE_ARG {
+		force = true
+		args = args[:len(args)-1]
+	}
+
+	// Split off the optional tolerance, overriding that of the round
+	tolerance := int64(current.tolerance) * kind.toleranceUnit
+	if len(args) > 0 && strings.HasPrefix(args[len(args)-1], TOLERANCE_PREFIX) {
+		units, err := strconv.Atoi(strings.TrimPrefix(args[len(args)-1], TOLERANCE_PREFIX))
+		if err != nil || units < 0 {
+			respond(message, "Could not read your tolerance.")
+			return
+		}
+		tolerance = int64(units) * kind.toleranceUnit
+		args = args[:len(args)-1]
+	}
+	if len(args) < 1 {
+		respond(message, "Format: bet end [" + kind.usage + "...] ["+TOLERANCE_PREFIX+"n] [" + FORCE_ARG + "] [round]")
+		return
+	}
+
+	results, err := formatTimes(kind, args, message)
+	if err != nil { return }
+	if len(results) > config.MaxSlots {
+		respond(message, "Note: bets have at most " + strconv.Itoa(config.MaxSlots) + " values, but " + strconv.Itoa(len(results)) + " results were given.")
+	}
+
+	current.Lock()
+	participants := len(current.bets)
+	current.Unlock()
+	if participants < current.minParticipants && !force {
+		respond(message, "Only " + strconv.Itoa(participants) + " of the required " + strconv.Itoa(current.minParticipants) + " participants have bet. Add " + FORCE_ARG + " to end the round anyway.")
+		return
+	}
+
+	// Take the round so no other handler can end it concurrently.
+	round := takeRound(message.Channel, current.name)
+	if round == nil {
+		respondError(message, ErrNoActiveRound)
+		return
+	}
+	roundsEndedTotal.Inc("")
+	saveState()
+	round.Lock()
+	round.close(sentAt(message))
+
+	winners := determineWinners(round, results, tolerance)
+	details := rankWinners(round, winners, results, tolerance)
+	pot := payOut(round, winners)
+	result := recordResult(message.Channel, round, results, winners)
+	recordRound(message.Channel, result.participants(), winners)
+	audit(AuditEntry{Event: "end", Channel: message.Channel, Round: round.name, User: message.User.DisplayName, Results: result.Results, Winners: winners})
+	announcement := winnersAnnouncement(winners, details)
+	round.Unlock()
+	saveState()
+	if pot > 0 && len(winners) > 0 {
+		announcement += POT_RESPONSE.format("{points}", strconv.FormatInt(pot, 10))
+	} else if pot > 0 {
+		announcement += " All wagers have been returned."
+	}
+	chat.Say(message.Channel, announcement)
+}
+
+// Formats the announcement of given winners of a round, along with the
+// details given per winner if any.
+func winnersAnnouncement(winners []string, details map[string]string) string {
+	if len(winners) == 0 {
+		return NO_WINNERS_RESPONSE.formatConfigured(config.NoWinnersAnnouncement)
+	}
+	entries := make([]string, len(winners))
+	for i, winner := range winners {
+		entries[i] = WINNER_RESPONSE.format("{winner}", winner)
+		if detail, exist := details[winner]; exist {
+			entries[i] += " (" + detail + ")"
+		}
+	}
+	return WINNERS_RESPONSE.formatConfigured(config.WinnersAnnouncement, "{winners}", strings.Join(entries, WINNER_SEPARATOR.format()))
+}
+
+// Reports the state of the current betting round.
+func betStatus(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+
+	round.Lock()
+	state := "open"
+	if round.closed {
+		state = "closed"
+	}
+	participants := len(round.bets)
+	mode := round.mode
+	round.Unlock()
+
+	respond(message, "Betting" + onRound(round.name) + " is "+state+" ("+mode+" mode) with "+strconv.Itoa(participants)+" participant(s).")
+}
+
+// Whispers the number of participants of a round and who they are to the
+// requesting moderator, leaving out their bets so nobody can be swayed.
+func betCount(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+
+	round.Lock()
+	users := make([]string, 0, len(round.bets))
+	for user := range round.bets {
+		users = append(users, user)
+	}
+	round.Unlock()
+	sort.Strings(users)
+
+	response := strconv.Itoa(len(users)) + " participant(s)" + onRound(round.name) + " on " + message.Channel
+	if len(users) == 0 {
+		respondPrivately(message, response + ".")
+		return
+	}
+	response += ":"
+	for i, user := range users {
+		// Stay within the length Twitch allows per message.
+		if len(response) + len(user) > MAX_COUNT_LENGTH {
+			response += " and " + strconv.Itoa(len(users) - i) + " more"
+			break
+		}
+		if i > 0 {
+			response += ","
+		}
+		response += " " + user
+	}
+	respondPrivately(message, response + ".")
+}
+
+// Whispers the rounds active on all joined channels, along with whether they
+// are closed and how many users bet on them.
+func activeRounds(message *twitch.PrivateMessage, args []string) {
+	rounds := allRounds()
+	if len(rounds) == 0 {
+		respondPrivately(message, "There are no active betting rounds.")
+		return
+	}
+	sort.Slice(rounds, func(i, j int) bool {
+		if rounds[i].channel != rounds[j].channel {
+			return rounds[i].channel < rounds[j].channel
+		}
+		return rounds[i].name < rounds[j].name
+	})
+
+	response := strconv.Itoa(len(rounds)) + " active round(s):"
+	for i, round := range rounds {
+		round.Lock()
+		state := "open"
+		if round.closed {
+			state = "closed"
+		}
+		entry := " " + round.channel
+		if round.name != "" {
+			entry += "/" + round.name
+		}
+		entry += " (" + state + ", " + strconv.Itoa(len(round.bets)) + " bet(s))"
+		round.Unlock()
+		// Stay within the length Twitch allows per message.
+		if len(response) + len(entry) > MAX_COUNT_LENGTH {
+			response += " and " + strconv.Itoa(len(rounds) - i) + " more"
+			break
+		}
+		if i > 0 {
+			response += ","
+		}
+		response += entry
+	}
+	respondPrivately(message, response + ".")
+}
+
+// Shows the most popular guesses of an open round.
+func betOdds(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+
+	round.Lock()
+	if round.closed {
+		round.Unlock()
+		respond(message, "Betting" + onRound(round.name) + " has closed, wait for the results!")
+		return
+	}
+	counts := make(map[Guess]int)
+	for _, bet := range round.bets {
+		for _, t := range bet.times {
+			counts[t]++
+		}
+	}
+	round.Unlock()
+
+	if len(counts) == 0 {
+		respond(message, "Nobody has bet" + onRound(round.name) + " yet!")
+		return
+	}
+	guesses := make([]Guess, 0, len(counts))
+	for guess := range counts {
+		guesses = append(guesses, guess)
+	}
+	sort.Slice(guesses, func(i, j int) bool {
+		if counts[guesses[i]] != counts[guesses[j]] {
+			return counts[guesses[i]] > counts[guesses[j]]
+		}
+		return guesses[i].value < guesses[j].value
+	})
+	if len(guesses) > ODDS_SIZE {
+		guesses = guesses[:ODDS_SIZE]
+	}
+	response := "Top guesses" + onRound(round.name) + ":"
+	for i, guess := range guesses {
+		if i > 0 {
+			response += ","
+		}
+		response += " " + guess.String() + " (" + strconv.Itoa(counts[guess]) + ")"
+	}
+	respond(message, response)
+}
+
+// Shows the users with the most wins on the channel.
+func betLeaderboard(message *twitch.PrivateMessage, args []string) {
+	entries := topWinners(message.Channel, leaderboardSize)
+	if len(entries) == 0 {
+		respond(message, "Nobody has won a betting round yet!")
+		return
+	}
+	response := LEADERBOARD_RESPONSE.format()
+	for i, entry := range entries {
+		response += " " + strconv.Itoa(i+1) + ". " + entry.user + " (" + strconv.Itoa(entry.wins) + ")"
+	}
+	respond(message, response)
+}
+
+// Shows the statistics of the given user, or of the requesting user if none
+// is given.
+func betStats(message *twitch.PrivateMessage, args []string) {
+	user := message.User.DisplayName
+	if len(args) > 0 {
+		user = strings.TrimPrefix(args[0], "@")
+	}
+	s, exist := lookupStats(message.Channel, user)
+	if !exist {
+		respond(message, "No betting history for " + user + ".")
+		return
+	}
+	respond(message, user + ": " + strconv.Itoa(s.Bets) + " bet(s) in " + strconv.Itoa(s.Rounds) + " round(s), " + strconv.Itoa(s.Wins) + " win(s).")
+}
+
+// Shows the current bet of the requesting user.
+func betMine(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+
+	round.Lock()
+	bet, exist := round.bets[message.User.DisplayName]
+	round.Unlock()
+
+	if !exist {
+		respond(message, "You have not placed a bet yet.")
+		return
+	}
+	if bet.wager > 0 {
+		respond(message, "Your bet: " + joinGuesses(bet.times) + ", wagering " + strconv.FormatInt(bet.wager, 10) + " point(s)")
+		return
+	}
+	respond(message, "Your bet: " + joinGuesses(bet.times))
+}
+
+// Retracts the bet of the requesting user.
+func betCancel(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+
+	round.Lock()
+	if round.closed {
+		round.Unlock()
+		respond(message, "Betting has closed, your bet can no longer be cancelled.")
+		return
+	}
+	if _, exist := round.bets[message.User.DisplayName]; exist && round.locked {
+		round.Unlock()
+		respondError(message, ErrBetLocked)
+		return
+	}
+	bet, exist := round.bets[message.User.DisplayName]
+	if exist {
+		refundWagers(message.Channel, map[string]*Bet{message.User.DisplayName: bet})
+	}
+	delete(round.bets, message.User.DisplayName)
+	round.Unlock()
+
+	if !exist {
+		respond(message, "You have no bet to cancel.")
+		return
+	}
+	saveState()
+	respond(message, "Your bet has been cancelled.")
+	slog.Info("Bet cancelled", "event", "cancel", "channel", message.Channel, "round", round.name, "user", message.User.DisplayName)
+	audit(AuditEntry{Event: "cancel", Channel: message.Channel, Round: round.name, User: message.User.DisplayName})
+}
+
+// Returns when Twitch received given message, or the current time if Twitch
+// did not say.
+func sentAt(message *twitch.PrivateMessage) time.Time {
+	if message.Time.IsZero() {
+		return time.Now()
+	}
+	return message.Time
+}
+
+// Records or updates the bet of given user on the round, wagering given
+// points, as sent at given time. Returns whether the bet was placed during
+// the grace period after closing. Returns ErrRoundClosed if the round no
+// longer accepts bets or is no longer open, ErrBetUnchanged or ErrBetLocked if the user bet
+// before, or a WagerError if the user can not afford the wager.
+func (round *BettingRound) place(user string, times []Guess, sent time.Time, wager int64) (bool, error) {
+	round.Lock()
+	defer round.Unlock()
+	// Compare the times Twitch received the messages rather than the times
+	// they are handled, so bets are refused from the moment of closing.
+	deadline := round.closedAt.Add(round.grace)
+	late := round.closed && !sent.Before(round.closedAt)
+	if round.closed && !sent.Before(deadline) {
+		return false, ErrRoundClosed
+	}
+	// A round ended, replaced or expired in the meantime is closed for
+	// good, and wagers on it would never be paid out nor refunded.
+	if getRound(round.channel, round.name) != round {
+		return false, ErrRoundClosed
+	}
+	previous, exist := round.bets[user]
+	if exist && previous.wager == wager && equalGuesses(previous.times, times) {
+		return false, ErrBetUnchanged
+	}
+	if exist && round.locked {
+		return false, ErrBetLocked
+	}
+	var previousWager int64
+	if exist {
+		previousWager = previous.wager
+	}
+	if !changeWager(round.channel, user, previousWager, wager) {
+		return false, &WagerError{wager, balanceOf(round.channel, user) + previousWager}
+	}
+	round.bets[user] = &Bet{times: times, placed: sent, late: late, wager: wager}
+	return late, nil
+}
+
+// Records or updates the bet of the requesting user.
+func placeBet(message *twitch.PrivateMessage, args []string) {
+	round, args := checkActiveBidding(message, args)
+	if round == nil { return }
+	if len(args) < 1 {
+		usage := "Format: bet <" + round.kind.usage + "...>"
+		if round.name != "" {
+			usage += " " + round.name
+		}
+		respond(message, usage)
+		return
+	}
+	args, wager, ok := splitWager(round.kind, args)
+	if !ok {
+		respond(message, "Your wager must be a whole number of points above 0.")
+		return
+	}
+	if len(args) > config.MaxSlots {
+		respond(message, "Your bet has too many values, bet at most " + strconv.Itoa(config.MaxSlots) + ".")
+		return
+	}
+
+	times, err := formatTimes(round.kind, args, message)
+	if err != nil { return }
+
+	late, err := round.place(message.User.DisplayName, times, sentAt(message), wager)
+	// Only users betting in private are told the round has closed, as they
+	// can not see it has.
+	if errors.Is(err, ErrRoundClosed) && !private(message) {
+		return
+	} else if err != nil {
+		respondError(message, err)
+		return
+	}
+	betsTotal.Inc("")
+	recordBet(message.Channel, message.User.DisplayName)
+	saveState()
+	slog.Info("Bet placed", "event", "bet", "channel", message.Channel, "round", round.name, "user", message.User.DisplayName, "private", private(message), "late", late)
+	audit(AuditEntry{Event: "bet", Channel: message.Channel, Round: round.name, User: message.User.DisplayName, Times: guessStrings(times), Amount: wager})
+	if private(message) {
+		respond(message, "Your bet of " + joinGuesses(times) + " on " + message.Channel + " has been recorded.")
+	} else if wager > 0 {
+		respond(message, "Wagered " + strconv.FormatInt(wager, 10) + " point(s), good luck!")
+	}
+}
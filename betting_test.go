@@ -0,0 +1,294 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns given values read as guesses of given kind.
+func guesses(t *testing.T, kind *Kind, values ...string) []Guess {
+	t.Helper()
+	parsed, err := parseGuesses(kind, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// Returns a round of times in given mode with given bets by user, the values
+// of a bet separated by spaces.
+func testRound(t *testing.T, mode string, bets map[string]string) *BettingRound {
+	t.Helper()
+	round := &BettingRound{RoundOptions: RoundOptions{kind: timeKind, mode: mode, tieBreak: TIEBREAK_ALL}, bets: make(map[string]*Bet)}
+	for user, values := range bets {
+		round.bets[user] = &Bet{times: guesses(t, timeKind, strings.Fields(values)...)}
+	}
+	return round
+}
+
+// Fails given test unless the winners are the expected ones, in any order.
+func expectWinners(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) == 0 && len(want) == 0 { return }
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("winners are %q, want %q", got, want)
+	}
+}
+
+func TestBetLifecycle(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "mod", "!bet start closest", "moderator")
+	expectTexts(t, fake.takeSaid(), "Betting has started! Closest guess wins, place your bets below!")
+
+	// Bets in chat are recorded silently.
+	send(channel, "alice", "!bet 15:04")
+	send(channel, "bob", "!bet 15:10")
+	expectTexts(t, fake.takeSaid())
+
+	send(channel, "viewer", "!bet status")
+	expectTexts(t, fake.takeSaid(), "viewer -> Betting is open (closest mode) with 2 participant(s).")
+
+	send(channel, "mod", "!bet close", "moderator")
+	expectTexts(t, fake.takeSaid(), "Betting has closed! 2 bet(s) locked in. Everyone, good luck!")
+
+	// Bets sent after closing are ignored.
+	send(channel, "carol", "!bet 15:05")
+	expectTexts(t, fake.takeSaid())
+
+	send(channel, "mod", "!bet end 15:05", "moderator")
+	expectTexts(t, fake.takeSaid(), "🎉 Congratulations to following winner(s): 🥳 - alice (off by 1m0s)")
+
+	send(channel, "mod", "!bet status", "moderator")
+	expectTexts(t, fake.takeSaid(), "mod -> There is currently no active bidding!")
+}
+
+func TestOnlyModeratorsStartRounds(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "viewer", "!bet start")
+	expectTexts(t, fake.takeSaid(), "viewer -> You need to be a moderator to use !bet start.")
+	if getRound(channel, "") != nil {
+		t.Fatal("a viewer started a round")
+	}
+}
+
+// Bets placed concurrently must all be recorded, and must not race with
+// closing and ending the round. Run with -race.
+func TestConcurrentBets(t *testing.T) {
+	useFakeChat(t)
+	channel := testChannel(t)
+	const bettors = 50
+
+	send(channel, "mod", "!bet start", "moderator")
+	var wg sync.WaitGroup
+	for i := 0; i < bettors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			send(channel, "user" + strconv.Itoa(i), "!bet 15:" + strconv.Itoa(10 + i % 50))
+		}(i)
+	}
+	wg.Wait()
+	round := getRound(channel, "")
+	round.Lock()
+	placed := len(round.bets)
+	round.Unlock()
+	if placed != bettors {
+		t.Fatalf("%d bet(s) recorded, want %d", placed, bettors)
+	}
+
+	// Bets racing closing and ending the round are either recorded or
+	// refused, never lost halfway.
+	send(channel, "mod", "!bet clear", "moderator")
+	for i := 0; i < bettors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			send(channel, "user" + strconv.Itoa(i), "!bet 16:" + strconv.Itoa(10 + i % 50))
+		}(i)
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		send(channel, "mod", "!bet close", "moderator")
+	}()
+	go func() {
+		defer wg.Done()
+		send(channel, "mod", "!bet end 16:10 force", "moderator")
+	}()
+	wg.Wait()
+	if getRound(channel, "") != nil {
+		t.Fatal("the round was not ended")
+	}
+}
+
+func TestToleranceEdge(t *testing.T) {
+	tolerance := 2 * timeKind.toleranceUnit
+	results := guesses(t, timeKind, "15:04")
+	for _, mode := range []string{MODE_EXACT, MODE_PARTIAL} {
+		t.Run(mode, func(t *testing.T) {
+			round := testRound(t, mode, map[string]string{
+				"early": "15:02",
+				"late": "15:06",
+				"tooearly": "15:01",
+				"toolate": "15:07",
+			})
+			expectWinners(t, determineWinners(round, results, tolerance), "early", "late")
+		})
+	}
+}
+
+func TestNoToleranceMatchesExactly(t *testing.T) {
+	round := testRound(t, MODE_EXACT, map[string]string{"exact": "15:04", "near": "15:05"})
+	expectWinners(t, determineWinners(round, guesses(t, timeKind, "15:04"), 0), "exact")
+}
+
+func TestToleranceWhenEnding(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "mod", "!bet start", "moderator")
+	send(channel, "edge", "!bet 15:02")
+	send(channel, "beyond", "!bet 15:01")
+	send(channel, "mod", "!bet end 15:04 +/-2", "moderator")
+	said := fake.takeSaid()
+	if last := said[len(said)-1]; !strings.Contains(last, "edge") || strings.Contains(last, "beyond") {
+		t.Errorf("announced %q, want only edge to win", last)
+	}
+}
+
+func TestDetermineWinners(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		bets map[string]string
+		results string
+		want []string
+	}{
+		// Values beyond the last result neither count nor disqualify.
+		{"more bets than results", MODE_EXACT, map[string]string{"extra": "15:04 16:00", "exact": "15:04", "wrong": "15:05 15:04"}, "15:04", []string{"extra", "exact"}},
+		{"more bets than results partial", MODE_PARTIAL, map[string]string{"extra": "15:04 16:00 17:00", "none": "15:05"}, "15:04", []string{"extra"}},
+		{"more bets than results closest", MODE_CLOSEST, map[string]string{"extra": "15:04 23:59", "near": "15:05"}, "15:04", []string{"extra"}},
+		// Results beyond the last value of a bet are missed.
+		{"more results than bets", MODE_EXACT, map[string]string{"short": "15:04", "full": "15:04 16:00"}, "15:04 16:00", []string{"full"}},
+		{"more results than bets partial", MODE_PARTIAL, map[string]string{"short": "15:04", "half": "15:04 17:00"}, "15:04 16:00", []string{"short", "half"}},
+		{"more results than bets closest", MODE_CLOSEST, map[string]string{"short": "15:04", "far": "15:04 20:00"}, "15:04 16:00", []string{"far"}},
+		{"no matches partial", MODE_PARTIAL, map[string]string{"wrong": "12:00"}, "15:04", nil},
+		{"no bets", MODE_EXACT, map[string]string{}, "15:04", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			round := testRound(t, test.mode, test.bets)
+			expectWinners(t, determineWinners(round, guesses(t, timeKind, strings.Fields(test.results)...), 0), test.want...)
+		})
+	}
+}
+
+func TestNoWinnersWithoutResults(t *testing.T) {
+	for _, mode := range []string{MODE_EXACT, MODE_CLOSEST, MODE_PARTIAL} {
+		round := testRound(t, mode, map[string]string{"user": "15:04"})
+		if winners := determineWinners(round, nil, 0); len(winners) > 0 {
+			t.Errorf("%s mode has winners %q without results", mode, winners)
+		}
+		if winners := determineWinners(round, []Guess{}, 0); len(winners) > 0 {
+			t.Errorf("%s mode has winners %q with empty results", mode, winners)
+		}
+	}
+}
+
+func TestWinnerDetails(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	end := func(start string, bets map[string]string, results string) string {
+		t.Helper()
+		send(channel, "mod", "!bet start " + start, "moderator")
+		for _, user := range []string{"alice", "bob", "carol"} {
+			if bet, exist := bets[user]; exist {
+				send(channel, user, "!bet " + bet)
+			}
+		}
+		fake.takeSaid()
+		send(channel, "mod", "!bet end " + results, "moderator")
+		said := fake.takeSaid()
+		return said[len(said)-1]
+	}
+
+	// Winners in exact mode matched everything, so nothing is added.
+	got := end("exact", map[string]string{"alice": "15:04", "bob": "15:04"}, "15:04")
+	if want := "🎉 Congratulations to following winner(s): 🥳 - alice 🥳 - bob"; got != want {
+		t.Errorf("exact mode announced %q, want %q", got, want)
+	}
+	// Partial mode counts the results missed.
+	got = end("partial", map[string]string{"alice": "15:04 16:00 18:00", "bob": "15:04 16:00", "carol": "15:04"}, "15:04 16:00 17:00")
+	if want := "🎉 Congratulations to following winner(s): 🥳 - alice (2/3 matched) 🥳 - bob (2/3 matched)"; got != want {
+		t.Errorf("partial mode announced %q, want %q", got, want)
+	}
+	// Closest mode ranks winners by distance.
+	got = end("closest", map[string]string{"alice": "15:04", "bob": "15:04"}, "15:05")
+	if want := "🎉 Congratulations to following winner(s): 🥳 - alice (off by 1m0s) 🥳 - bob (off by 1m0s)"; got != want {
+		t.Errorf("closest mode announced %q, want %q", got, want)
+	}
+}
+
+func TestBareBetStoresNothing(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "mod", "!bet start", "moderator")
+	fake.takeSaid()
+	send(channel, "viewer", "!bet")
+	expectTexts(t, fake.takeSaid(), "viewer -> Format: bet <HH:MM...>")
+	round := getRound(channel, "")
+	round.Lock()
+	defer round.Unlock()
+	if bet, exist := round.bets["viewer"]; exist {
+		t.Errorf("a bare bet stored %+v", bet)
+	}
+}
+
+func TestBetStats(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "mod", "!bet start", "moderator")
+	send(channel, "alice", "!bet 15:04")
+	fake.takeSaid()
+	for _, user := range []string{"alice", "@alice", "Alice"} {
+		send(channel, "mod", "!bet stats " + user, "moderator")
+	}
+	send(channel, "mod", "!bet stats @nobody", "moderator")
+	expectTexts(t, fake.takeSaid(),
+		"mod -> alice: 1 bet(s) in 0 round(s), 0 win(s).",
+		"mod -> alice: 1 bet(s) in 0 round(s), 0 win(s).",
+		"mod -> Alice: 1 bet(s) in 0 round(s), 0 win(s).",
+		"mod -> No betting history for nobody.",
+	)
+}
+
+// Rounds must not expire unless configured to, as that drops their bets.
+func TestRoundsDoNotExpireByDefault(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "mod", "!bet start", "moderator")
+	fake.takeSaid()
+	round := getRound(channel, "")
+	round.Lock()
+	round.started = round.started.Add(-365 * 24 * time.Hour)
+	round.Unlock()
+	expireOldRounds()
+	if getRound(channel, "") != round {
+		t.Error("the round expired by default")
+	}
+	expectTexts(t, fake.takeSaid())
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Whether to post the introduction on every channel joined on startup.
+// Only the log receives the introduction when unset.
+const ENV_ANNOUNCE_JOIN = "FRAMMIEBOT_ANNOUNCE_JOIN"
+
+// The comma separated channels the bot may join, overriding the allowed
+// channels of the configuration file.
+const ENV_ALLOWED_CHANNELS = "FRAMMIEBOT_ALLOWED_CHANNELS"
+
+// The comma separated channels to join on startup, along with the channels
+// given as arguments.
+const ENV_CHANNELS = "FRAMMIEBOT_CHANNELS"
+
+// The delay between introductions on consecutive channels.
+const ANNOUNCE_DELAY = 2 * time.Second
+
+// The window Twitch applies its join rate limit over.
+const JOIN_WINDOW = 10 * time.Second
+
+// The number of channels joined per join window when none is configured,
+// the limit Twitch applies to regular accounts.
+const DEFAULT_JOIN_RATE = 20
+
+// The most added at random to the wait between batches of joins, so joins
+// never quite reach the limit of Twitch.
+const JOIN_JITTER = time.Second
+
+// The channels the bot is currently in.
+var joined = struct {
+	sync.Mutex
+	channels map[string]bool
+}{channels: make(map[string]bool)}
+
+// Converts a channel name to the form used by Twitch.
+func normalizeChannel(channel string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(channel), "#"))
+}
+
+// Combines given lists of channel names into a single list of normalized
+// names, keeping the first occurrence of each. Empty names are dropped.
+func mergeChannels(lists ...[]string) []string {
+	var channels []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, channel := range list {
+			channel = normalizeChannel(channel)
+			if channel == "" || seen[channel] { continue }
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// Joins given channel. Returns false if the channel was already joined.
+func joinChannel(channel string) bool {
+	joined.Lock()
+	defer joined.Unlock()
+	if joined.channels[channel] { return false }
+	joined.channels[channel] = true
+	chat.Join(channel)
+	slog.Info("Joined channel", "event", "join", "channel", channel)
+	return true
+}
+
+// The channels the introduction has been posted on since startup.
+var introduced = struct {
+	sync.Mutex
+	channels map[string]bool
+}{channels: make(map[string]bool)}
+
+// Joins given channels, in batches of the configured join rate per join
+// window so Twitch does not drop joins beyond its limit. The first batch is
+// joined right away, the others in the background while connected. The
+// introduction is posted on newly joined channels if announceJoin is set.
+func joinStaggered(channels []string, announceJoin bool) {
+	configLock.RLock()
+	rate := config.JoinRate
+	configLock.RUnlock()
+
+	joinBatch := func(batch []string) {
+		var newlyJoined []string
+		for _, channel := range batch {
+			if joinChannel(channel) {
+				newlyJoined = append(newlyJoined, channel)
+			}
+		}
+		if announceJoin {
+			go announce(newlyJoined, ANNOUNCE_DELAY)
+		}
+	}
+	if len(channels) <= rate {
+		joinBatch(channels)
+		return
+	}
+
+	joinBatch(channels[:rate])
+	slog.Info("Joining channels in batches", "event", "join", "joined", rate, "total", len(channels), "batch", rate)
+	go joinBatches(channels, rate, joinBatch)
+}
+
+// Held while waiting for and joining a batch of channels, so batches joined
+// in the background at once still keep to the join rate together.
+var batches sync.Mutex
+
+// Passes the batches of given size of given channels, from the second batch
+// on, to given function, waiting a join window between batches and for the
+// connection to be up. The first batch is expected to be joined already.
+func joinBatches(channels []string, rate int, join func(batch []string)) {
+	for start := rate; start < len(channels); start += rate {
+		batches.Lock()
+		time.Sleep(JOIN_WINDOW + time.Duration(rand.Int63n(int64(JOIN_JITTER))))
+		for !connected.Load() {
+			time.Sleep(time.Second)
+		}
+		end := min(start + rate, len(channels))
+		join(channels[start:end])
+		batches.Unlock()
+		slog.Info("Joined batch of channels", "event", "join", "joined", end, "total", len(channels))
+	}
+}
+
+// Rejoins the joined channels beyond the first batch in batches after a
+// reconnect. The client rejoins every channel it knows at once on
+// reconnecting, and Twitch drops the joins beyond its limit, so those
+// channels are departed and joined again at the configured join rate.
+func rejoinStaggered() {
+	configLock.RLock()
+	rate := config.JoinRate
+	configLock.RUnlock()
+
+	channels := joinedChannels()
+	if len(channels) <= rate { return }
+	for _, channel := range channels[rate:] {
+		chat.Depart(channel)
+	}
+	slog.Info("Rejoining channels in batches", "event", "join", "joined", rate, "total", len(channels), "batch", rate)
+	go joinBatches(channels, rate, func(batch []string) {
+		// Channels left in the meantime stay departed.
+		joined.Lock()
+		defer joined.Unlock()
+		for _, channel := range batch {
+			if joined.channels[channel] {
+				chat.Join(channel)
+			}
+		}
+	})
+}
+
+// Posts the introduction on given channels, waiting given delay between
+// channels.
+func announce(channels []string, delay time.Duration) {
+	for i, channel := range channels {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+		introduced.Lock()
+		introduced.channels[channel] = true
+		introduced.Unlock()
+		configLock.RLock()
+		chat.Say(channel, config.Introduction)
+		configLock.RUnlock()
+	}
+}
+
+// Posts the introduction again on the joined channels it has been posted on
+// before, waiting given delay between channels.
+func reintroduce(delay time.Duration) {
+	var channels []string
+	introduced.Lock()
+	for _, channel := range joinedChannels() {
+		if introduced.channels[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	introduced.Unlock()
+	announce(channels, delay)
+}
+
+// Leaves given channel. Returns false if the channel was not joined.
+func leaveChannel(channel string) bool {
+	joined.Lock()
+	defer joined.Unlock()
+	if !joined.channels[channel] { return false }
+	delete(joined.channels, channel)
+	chat.Depart(channel)
+	slog.Info("Left channel", "event", "leave", "channel", channel)
+	return true
+}
+
+// Whether the bot may join given channel. All channels are allowed when no
+// allowed channels are configured.
+func allowedChannel(channel string) bool {
+	if len(config.AllowedChannels) == 0 { return true }
+	for _, allowed := range config.AllowedChannels {
+		if normalizeChannel(allowed) == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the bot is in given channel.
+func isJoined(channel string) bool {
+	joined.Lock()
+	defer joined.Unlock()
+	return joined.channels[channel]
+}
+
+// Returns the names of all joined channels in alphabetical order.
+func joinedChannels() []string {
+	joined.Lock()
+	defer joined.Unlock()
+	channels := make([]string, 0, len(joined.channels))
+	for channel := range joined.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Makes the bot join the given channel.
+func join(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 1 {
+		respond(message, "Format: join <channel>")
+		return
+	}
+	channel := normalizeChannel(args[0])
+	if !allowedChannel(channel) {
+		respond(message, "I am not allowed to join " + channel + ".")
+		return
+	}
+	if !joinChannel(channel) {
+		respond(message, "I am already in " + channel + ".")
+		return
+	}
+	respond(message, "Joined " + channel + ".")
+}
+
+// Makes the bot leave the given channel.
+func leave(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 1 {
+		respond(message, "Format: leave <channel>")
+		return
+	}
+	channel := normalizeChannel(args[0])
+	// Respond first, as we can no longer talk in the channel once left. The
+	// channel is left once the goodbye has been said.
+	if channel == message.Channel {
+		respond(message, "Leaving " + channel + ", bye!")
+	}
+	if !leaveChannel(channel) {
+		respond(message, "I am not in " + channel + ".")
+		return
+	}
+	if channel != message.Channel {
+		respond(message, "Left " + channel + ".")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Makes given channels the allowed channels for the duration of given test.
+func allowChannels(t *testing.T, channels ...string) {
+	previous := config
+	c := *config
+	c.AllowedChannels = channels
+	config = &c
+	t.Cleanup(func() { config = previous })
+}
+
+func TestDisallowedChannelIsNotJoined(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	allowChannels(t, channel, "#Allowed")
+
+	send(channel, owner, "!join elsewhere")
+	expectTexts(t, fake.takeSaid(), owner + " -> I am not allowed to join elsewhere.")
+	if len(fake.joined) > 0 || isJoined("elsewhere") {
+		t.Fatalf("joined %q", fake.joined)
+	}
+
+	// Allowed channels are compared normalized.
+	send(channel, owner, "!join allowed")
+	t.Cleanup(func() { leaveChannel("allowed") })
+	expectTexts(t, fake.takeSaid(), owner + " -> Joined allowed.")
+	if len(fake.joined) != 1 || fake.joined[0] != "allowed" {
+		t.Fatalf("joined %q, want allowed", fake.joined)
+	}
+}
+
+func TestAllChannelsAllowedWithoutList(t *testing.T) {
+	allowChannels(t)
+	if !allowedChannel("anywhere") {
+		t.Error("a channel is not allowed without allowed channels")
+	}
+}
+
+func TestMergeChannels(t *testing.T) {
+	args := []string{"Frammie", "#other"}
+	env := strings.Split(" third , #FRAMMIE,,other ,#Fourth", ",")
+	got := mergeChannels(args, env)
+	want := []string{"frammie", "other", "third", "fourth"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged %q, want %q", got, want)
+	}
+	// An unset variable splits into a single empty name.
+	if got := mergeChannels(nil, strings.Split("", ",")); len(got) != 0 {
+		t.Errorf("merged %q, want no channels", got)
+	}
+}
+
+func TestRejoinAfterReconnect(t *testing.T) {
+	fake := useFakeChat(t)
+	previous := config
+	c := *config
+	c.JoinRate = 2
+	config = &c
+	t.Cleanup(func() { config = previous })
+	channels := []string{"rejoin_a", "rejoin_b", "rejoin_c", "rejoin_d", "rejoin_e"}
+	for _, channel := range channels {
+		joinChannel(channel)
+		t.Cleanup(func() { leaveChannel(channel) })
+	}
+	fake.joined = nil
+
+	// Only the first batch is kept, the others are joined again later.
+	rejoinStaggered()
+	if want := channels[2:]; !reflect.DeepEqual(fake.departed, want) {
+		t.Errorf("departed %q, want %q", fake.departed, want)
+	}
+	if len(fake.joined) > 0 {
+		t.Errorf("rejoined %q at once", fake.joined)
+	}
+	for _, channel := range channels {
+		if !isJoined(channel) {
+			t.Errorf("%s is no longer joined", channel)
+		}
+	}
+}
+
+func TestNoRejoinWithinJoinRate(t *testing.T) {
+	fake := useFakeChat(t)
+	joinChannel("rejoin_single")
+	t.Cleanup(func() { leaveChannel("rejoin_single") })
+
+	rejoinStaggered()
+	if len(fake.departed) > 0 {
+		t.Errorf("departed %q", fake.departed)
+	}
+}
+
+// The goodbye is queued for the rate limit, so leaving must wait for it.
+func TestGoodbyeBeforeLeaving(t *testing.T) {
+	fake := useFakeChat(t)
+	chat = &SplittingChat{newRateLimitedChat(fake, DEFAULT_MESSAGE_RATE)}
+	channel := testChannel(t)
+	joinChannel(channel)
+	t.Cleanup(func() { leaveChannel(channel) })
+
+	send(channel, owner, "!leave " + channel)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fake.Lock()
+		departed, said := len(fake.departed), len(fake.said)
+		fake.Unlock()
+		if departed > 0 {
+			if said == 0 {
+				t.Fatal("left before saying goodbye")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the channel was never left")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	expectTexts(t, fake.takeSaid(), owner + " -> Leaving " + channel + ", bye!")
+	if isJoined(channel) {
+		t.Error("the channel is still joined")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gempir/go-twitch-irc/v2"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// The longest message Twitch accepts, in characters.
+const MAX_MESSAGE_LENGTH = 500
+
+// A Sayer sends messages to chat.
+type Sayer interface {
+	Say(channel string, text string)
+}
+
+// A ChatClient is a Sayer that can also whisper to users and join and leave
+// channels.
+type ChatClient interface {
+	Sayer
+	Whisper(username string, text string)
+	Join(channels ...string)
+	Depart(channel string)
+}
+
+// The Twitch client is the chat client used outside of dry runs.
+var _ ChatClient = (*twitch.Client)(nil)
+
+// The client all chat messages and channel changes go through. Handlers
+// must use this rather than the Twitch client, so they can run without a
+// connection to Twitch.
+var chat ChatClient
+
+// A SplittingChat is a ChatClient that splits messages and whispers too long
+// for Twitch into several, sent in order through the wrapped client. Parts
+// leave room for the suffix making duplicate messages unique.
+type SplittingChat struct {
+	ChatClient
+}
+
+// Says given message in as many parts as needed.
+func (c *SplittingChat) Say(channel string, text string) {
+	for _, part := range splitMessage(text, MAX_MESSAGE_LENGTH - utf8.RuneCountInString(DUPLICATE_SUFFIX)) {
+		c.ChatClient.Say(channel, part)
+	}
+}
+
+// Whispers given message in as many parts as needed.
+func (c *SplittingChat) Whisper(username string, text string) {
+	for _, part := range splitMessage(text, MAX_MESSAGE_LENGTH) {
+		c.ChatClient.Whisper(username, part)
+	}
+}
+
+// Splits given text into parts of at most given number of characters,
+// breaking between words unless a single word is too long.
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	for utf8.RuneCountInString(text) > limit {
+		// Find where the character beyond the limit starts.
+		cut := 0
+		for i := 0; i < limit; i++ {
+			_, size := utf8.DecodeRuneInString(text[cut:])
+			cut += size
+		}
+		if text[cut] != ' ' {
+			if space := strings.LastIndexByte(text[:cut], ' '); space > 0 {
+				cut = space
+			}
+		}
+		parts = append(parts, strings.TrimRight(text[:cut], " "))
+		text = strings.TrimLeft(text[cut:], " ")
+	}
+	return append(parts, text)
+}
+
+// A WriterChat writes chat messages to a writer instead of sending them.
+type WriterChat struct {
+	w io.Writer
+}
+
+// Writes given message, prefixed by the channel it was meant for.
+func (c *WriterChat) Say(channel string, text string) {
+	fmt.Fprintf(c.w, "#%s: %s\n", channel, text)
+}
+
+// Writes given whisper, prefixed by the user it was meant for.
+func (c *WriterChat) Whisper(username string, text string) {
+	fmt.Fprintf(c.w, "@%s: %s\n", username, text)
+}
+
+// Writes a line for every joined channel.
+func (c *WriterChat) Join(channels ...string) {
+	for _, channel := range channels {
+		fmt.Fprintf(c.w, "* joined #%s\n", channel)
+	}
+}
+
+// Writes a line for the departed channel.
+func (c *WriterChat) Depart(channel string) {
+	fmt.Fprintf(c.w, "* left #%s\n", channel)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// A message sent through a fakeChat, to a channel or as a whisper to a user.
+type sentMessage struct {
+	to string
+	text string
+}
+
+// A fakeChat is a ChatClient capturing everything sent through it, so tests
+// can assert on the responses of handlers.
+type fakeChat struct {
+	sync.Mutex
+	said []sentMessage
+	whispered []sentMessage
+	joined []string
+	departed []string
+}
+
+// Captures given message.
+func (c *fakeChat) Say(channel string, text string) {
+	c.Lock()
+	defer c.Unlock()
+	c.said = append(c.said, sentMessage{channel, text})
+}
+
+// Captures given whisper.
+func (c *fakeChat) Whisper(username string, text string) {
+	c.Lock()
+	defer c.Unlock()
+	c.whispered = append(c.whispered, sentMessage{username, text})
+}
+
+// Captures the joined channels.
+func (c *fakeChat) Join(channels ...string) {
+	c.Lock()
+	defer c.Unlock()
+	c.joined = append(c.joined, channels...)
+}
+
+// Captures the departed channel.
+func (c *fakeChat) Depart(channel string) {
+	c.Lock()
+	defer c.Unlock()
+	c.departed = append(c.departed, channel)
+}
+
+// Returns the texts of the messages said since the last call, in order.
+func (c *fakeChat) takeSaid() []string {
+	c.Lock()
+	defer c.Unlock()
+	texts := make([]string, len(c.said))
+	for i, message := range c.said {
+		texts[i] = message.text
+	}
+	c.said = nil
+	return texts
+}
+
+// Returns the texts of the whispers sent since the last call, in order.
+func (c *fakeChat) takeWhispered() []string {
+	c.Lock()
+	defer c.Unlock()
+	texts := make([]string, len(c.whispered))
+	for i, message := range c.whispered {
+		texts[i] = message.text
+	}
+	c.whispered = nil
+	return texts
+}
+
+// Makes a fake the chat client for the duration of given test.
+func useFakeChat(t *testing.T) *fakeChat {
+	fake := &fakeChat{}
+	previous := chat
+	chat = fake
+	t.Cleanup(func() { chat = previous })
+	return fake
+}
+
+// Fails given test unless the texts are the expected ones, in order.
+func expectTexts(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d message(s) %q, want %d %q", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// Fails given test unless given parts of given text split at given limit
+// are valid, within the limit and together make up the text.
+func expectSplit(t *testing.T, text string, limit int, parts []string) {
+	t.Helper()
+	for i, part := range parts {
+		if !utf8.ValidString(part) {
+			t.Errorf("part %d is not valid UTF-8: %q", i, part)
+		}
+		if length := utf8.RuneCountInString(part); length > limit || length == 0 {
+			t.Errorf("part %d has %d characters, want 1 to %d: %q", i, length, limit, part)
+		}
+	}
+	if joined := strings.Join(parts, ""); strings.ReplaceAll(joined, " ", "") != strings.ReplaceAll(text, " ", "") {
+		t.Errorf("parts %q do not make up %q", parts, text)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	if parts := splitMessage("short message", 20); len(parts) != 1 || parts[0] != "short message" {
+		t.Errorf("short message splits into %q", parts)
+	}
+	if parts := splitMessage(strings.Repeat("x", 20), 20); len(parts) != 1 {
+		t.Errorf("message at the limit splits into %q", parts)
+	}
+
+	words := strings.TrimSpace(strings.Repeat("betting round ", 100))
+	parts := splitMessage(words, MAX_MESSAGE_LENGTH)
+	expectSplit(t, words, MAX_MESSAGE_LENGTH, parts)
+	if len(parts) != 3 {
+		t.Errorf("got %d parts, want 3", len(parts))
+	}
+	// Parts break between words.
+	for i, part := range parts {
+		for _, word := range strings.Fields(part) {
+			if word != "betting" && word != "round" {
+				t.Errorf("part %d breaks word %q", i, word)
+			}
+		}
+		if strings.HasPrefix(part, " ") || strings.HasSuffix(part, " ") {
+			t.Errorf("part %d is not trimmed: %q", i, part)
+		}
+	}
+}
+
+func TestSplitMultibyteMessage(t *testing.T) {
+	// Characters of two, three and four bytes, counted as one each.
+	text := strings.TrimSpace(strings.Repeat("wörld ☕ 🎉🥳 ", 60))
+	parts := splitMessage(text, 100)
+	expectSplit(t, text, 100, parts)
+
+	// A single word beyond the limit is cut between characters.
+	word := strings.Repeat("é", 25)
+	parts = splitMessage(word, 10)
+	expectTexts(t, parts, strings.Repeat("é", 10), strings.Repeat("é", 10), strings.Repeat("é", 5))
+	emoji := strings.Repeat("🎉", 7)
+	parts = splitMessage(emoji, 3)
+	expectTexts(t, parts, "🎉🎉🎉", "🎉🎉🎉", "🎉")
+}
+
+func TestSplittingChat(t *testing.T) {
+	fake := &fakeChat{}
+	splitting := &SplittingChat{fake}
+	text := strings.TrimSpace(strings.Repeat("lorem ipsum ", 100))
+
+	splitting.Say("channel", text)
+	said := fake.takeSaid()
+	expectSplit(t, text, MAX_MESSAGE_LENGTH - utf8.RuneCountInString(DUPLICATE_SUFFIX), said)
+	if len(said) < 2 {
+		t.Errorf("a message of %d characters is said at once", len(text))
+	}
+
+	splitting.Whisper("user", text)
+	expectSplit(t, text, MAX_MESSAGE_LENGTH, fake.takeWhispered())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"sync"
+)
+
+// The channels on which the coffee response to the water trigger is turned
+// off. Enabled on all other channels.
+var coffee = struct {
+	sync.Mutex
+	disabled map[string]bool
+}{disabled: make(map[string]bool)}
+
+// Whether the coffee response is enabled on given channel.
+func coffeeEnabled(channel string) bool {
+	coffee.Lock()
+	defer coffee.Unlock()
+	return !coffee.disabled[channel]
+}
+
+// Turns the coffee response on given channel on or off.
+func setCoffee(channel string, enabled bool) {
+	coffee.Lock()
+	if enabled {
+		delete(coffee.disabled, channel)
+	} else {
+		coffee.disabled[channel] = true
+	}
+	coffee.Unlock()
+	saveState()
+}
+
+// Turns the coffee response on the channel on or off.
+func coffeeCommand(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 1 {
+		respond(message, "Format: coffee <on|off>")
+		return
+	}
+	switch args[0] {
+		case "on":
+			setCoffee(message.Channel, true)
+			respond(message, COFFEE_ON_RESPONSE.format())
+		case "off":
+			setCoffee(message.Channel, false)
+			respond(message, "No more coffee for this channel.")
+		default:
+			respond(message, "Format: coffee <on|off>")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The number of sides of the die rolled when none is given.
+const DEFAULT_DIE_SIDES = 6
+
+// The largest number of sides a die may have.
+const MAX_DIE_SIDES = 1000000
+
+// A Command is a chat command understood by the bot. Its usage and
+// description are used to generate the help output.
+type Command struct {
+	name string
+	// Other names the command can be run by, such as shorthands.
+	aliases []string
+	usage string
+	description string
+	// The level required to run the command, unless configured otherwise.
+	permission Level
+	// Whether the command is reserved to administrators of the bot.
+	admin bool
+	// Whether the command is subject to a cooldown for unauthorized users.
+	cooldown bool
+	// Called with the arguments following the command name.
+	handler func(message *twitch.PrivateMessage, args []string)
+	// Subcommands listed in the detailed help of the command.
+	subcommands []*Command
+}
+
+// The top-level commands of the bot. Populated on init, as the help command
+// refers back to this list.
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		{name: "bet", aliases: []string{"b"}, usage: "<value...> [round]", description: "place a bet", handler: bet, subcommands: betCommands},
+		{name: "coffee", usage: "<on|off>", description: "turn the coffee response on or off", permission: LEVEL_MOD, handler: coffeeCommand},
+		{name: "subs", usage: "<on|off>", description: "turn thanking subscribers on or off", permission: LEVEL_MOD, handler: subsCommand},
+		{name: "prefix", usage: "<prefix|reset>", description: "change the command prefix of the channel", permission: LEVEL_MOD, handler: prefixCommand},
+		{name: "addcommand", usage: "<name> <response>", description: "add a command responding with given text", permission: LEVEL_MOD, handler: addCommand},
+		{name: "delcommand", usage: "<name>", description: "remove a command added with addcommand", permission: LEVEL_MOD, handler: delCommand},
+		{name: "join", usage: "<channel>", description: "make the bot join a channel", admin: true, handler: join},
+		{name: "leave", usage: "<channel>", description: "make the bot leave a channel", admin: true, handler: leave},
+		{name: "rounds", description: "whisper the active betting rounds of all channels", admin: true, handler: activeRounds},
+		{name: "points", usage: "[user]", description: "show a points balance", cooldown: true, handler: pointsCommand},
+		{name: "givepoints", usage: "<user> <amount>", description: "give points to a user, or take them with a negative amount", permission: LEVEL_MOD, handler: givePoints},
+		{name: "resetuser", usage: "<user>", description: "reset the stats and points of a user", permission: LEVEL_MOD, handler: resetUser},
+		{name: "resetchannel", usage: "[" + CONFIRM_ARG + "]", description: "reset the stats and points of everyone", permission: LEVEL_BROADCASTER, handler: resetChannel},
+		{name: "config", description: "whisper the settings in effect", permission: LEVEL_MOD, handler: configCommand},
+		{name: "botstats", description: "show operational statistics of the bot", permission: LEVEL_MOD, handler: botStats},
+		{name: "version", description: "show the running version", cooldown: true, handler: version},
+		{name: "uptime", description: "show how long the bot has been running", cooldown: true, handler: uptime},
+		{name: "ping", description: "check that the bot is responding", cooldown: true, handler: ping},
+		{name: "roll", usage: "[sides]", description: "roll a die, " + strconv.Itoa(DEFAULT_DIE_SIDES) + "-sided unless given", cooldown: true, handler: roll},
+		{name: "help", aliases: []string{"commands"}, usage: "[command]", description: "show available commands", cooldown: true, handler: help},
+	}
+}
+
+// Returns the command with given name or alias from given list, or nil if
+// there is none. Names are matched regardless of case.
+func findCommand(list []*Command, name string) *Command {
+	name = strings.ToLower(name)
+	for _, command := range list {
+		if command.name == name {
+			return command
+		}
+		for _, alias := range command.aliases {
+			if alias == name {
+				return command
+			}
+		}
+	}
+	return nil
+}
+
+// Runs the command from given list named by the first argument, the list
+// being the subcommands of given parents if any. Returns false if no such
+// command exists.
+func runCommand(list []*Command, message *twitch.PrivateMessage, args []string, parents ...string) bool {
+	command := findCommand(list, args[0])
+	if command == nil { return false }
+	path := strings.Join(append(parents, command.name), " ")
+	if err := checkPermission(command, path, &message.User); err != nil {
+		var permissionErr *PermissionError
+		errors.As(err, &permissionErr)
+		deny(message, path, permissionErr.who)
+		return true
+	}
+	if command.cooldown && !authorized(&message.User) {
+		if left := startCooldown(message.Channel, command, config.Cooldown.Duration); left > 0 {
+			cooling(message, command, path, left)
+			return true
+		}
+	}
+	commandsTotal.Inc(command.name)
+	slog.Debug("Running command", "event", "command", "channel", message.Channel, "user", message.User.DisplayName, "command", command.name)
+	command.handler(message, args[1:])
+	return true
+}
+
+// Checks whether given user may run given command, named by given path.
+// Returns a PermissionError telling who may otherwise.
+func checkPermission(command *Command, path string, user *twitch.User) error {
+	if level := requiredLevel(command, path); userLevel(user) < level {
+		return &PermissionError{levelDescriptions[level]}
+	}
+	if command.admin && !admin(user) {
+		return &PermissionError{"the owner of the bot"}
+	}
+	return nil
+}
+
+// Tells the sender of given message they may not run the command at given
+// path, as only given kind of user may. The response is subject to the
+// cooldown, so users trying repeatedly can not flood the chat.
+func deny(message *twitch.PrivateMessage, path string, who string) {
+	if config.DeniedResponse == "" { return }
+	if !checkCooldown(message.Channel, "denied", config.Cooldown.Duration) { return }
+	respond(message, strings.NewReplacer("{level}", who, "{command}", prefixOf(message.Channel) + path).Replace(config.DeniedResponse))
+}
+
+// A user told a command is on cooldown, who is told so only once until the
+// command is off cooldown again.
+type coolingUser struct {
+	command *Command
+	user string
+}
+
+// Tells the sender of given message that the command at given path remains
+// on cooldown for given duration, if configured.
+func cooling(message *twitch.PrivateMessage, command *Command, path string, left time.Duration) {
+	if config.CooldownResponse == "" { return }
+	if !checkCooldown(message.Channel, coolingUser{command, message.User.Name}, left) { return }
+	seconds := strconv.Itoa(int(math.Ceil(left.Seconds())))
+	respond(message, strings.NewReplacer("{command}", prefixOf(message.Channel) + path, "{seconds}", seconds).Replace(config.CooldownResponse))
+}
+
+// Formats the syntax of given command starting with given prefix, followed
+// by the names of its parents.
+func syntax(prefix string, command *Command, parents ...string) string {
+	s := prefix + strings.Join(append(parents, command.name), " ")
+	if command.usage != "" {
+		s += " " + command.usage
+	}
+	return s
+}
+
+// Lists the names of the available commands, or the detailed syntax of a
+// single command. The list leaves syntax and subcommands to the latter, so
+// it fits in a single message.
+func help(message *twitch.PrivateMessage, args []string) {
+	prefix := prefixOf(message.Channel)
+	if len(args) > 0 {
+		command := findCommand(commands, args[0])
+		if command == nil {
+			respond(message, "Unknown command " + args[0] + ".")
+			return
+		}
+		details := []string{syntax(prefix, command) + ": " + command.description}
+		if len(command.aliases) > 0 {
+			details[0] += " (also " + prefix + strings.Join(command.aliases, ", " + prefix) + ")"
+		}
+		for _, sub := range command.subcommands {
+			details = append(details, syntax(prefix, sub, command.name) + ": " + sub.description)
+		}
+		respond(message, strings.Join(details, " | "))
+		return
+	}
+
+	list := make([]string, len(commands))
+	for i, command := range commands {
+		list[i] = prefix + command.name
+	}
+	response := "Commands: " + strings.Join(list, ", ") + "."
+	if names := customNames(message.Channel); len(names) > 0 {
+		response += " Custom: " + prefix + strings.Join(names, ", " + prefix) + "."
+	}
+	respond(message, response + " Use " + prefix + "help [command] for details.")
+}
+
+// Reports the running version, along with the commit it was built from if
+// known.
+func version(message *twitch.PrivateMessage, args []string) {
+	s := "frammiebot v" + VERSION
+	if commit != "" {
+		s += " (" + commit + ")"
+	}
+	respond(message, s)
+}
+
+// Formats given duration compactly in days, hours and minutes, such as
+// "1d3h14m", or in seconds if shorter than a minute.
+func formatUptime(d time.Duration) string {
+	if d < time.Minute {
+		return strconv.Itoa(int(d.Seconds())) + "s"
+	}
+	minutes := int(d.Minutes())
+	s := ""
+	if days := minutes / (24 * 60); days > 0 {
+		s += strconv.Itoa(days) + "d"
+	}
+	if hours := minutes / 60 % 24; s != "" || hours > 0 {
+		s += strconv.Itoa(hours) + "h"
+	}
+	return s + strconv.Itoa(minutes % 60) + "m"
+}
+
+// Reports how long the bot has been running.
+func uptime(message *twitch.PrivateMessage, args []string) {
+	respond(message, "up " + formatUptime(time.Since(startedAt)))
+}
+
+// Replies to show the bot is receiving and sending messages, along with how
+// long the message took to reach the bot. The delay is left out when the
+// clocks of Twitch and the bot disagree.
+func ping(message *twitch.PrivateMessage, args []string) {
+	delay := time.Since(message.Time)
+	if message.Time.IsZero() || delay < 0 {
+		respond(message, "pong")
+		return
+	}
+	respond(message, "pong (" + delay.Round(time.Millisecond).String() + ")")
+}
+
+// Rolls a die with the given number of sides.
+func roll(message *twitch.PrivateMessage, args []string) {
+	sides := DEFAULT_DIE_SIDES
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 2 || n > MAX_DIE_SIDES {
+			respond(message, "A die has 2 to " + strconv.Itoa(MAX_DIE_SIDES) + " sides, such as " + prefixOf(message.Channel) + "roll 20.")
+			return
+		}
+		sides = n
+	}
+	respond(message, ROLL_RESPONSE.format("{roll}", strconv.Itoa(rand.Intn(sides) + 1), "{sides}", strconv.Itoa(sides)))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHelpFitsInOneMessage(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "viewer", "!help")
+	said := fake.takeSaid()
+	if len(said) != 1 {
+		t.Fatalf("got %d messages, want 1", len(said))
+	}
+	if length := utf8.RuneCountInString(said[0]); length > MAX_MESSAGE_LENGTH - utf8.RuneCountInString(DUPLICATE_SUFFIX) {
+		t.Errorf("help is %d characters, which is split into several messages: %q", length, said[0])
+	}
+	for _, command := range commands {
+		if !strings.Contains(said[0], "!" + command.name) {
+			t.Errorf("help does not list %s: %q", command.name, said[0])
+		}
+	}
+}
+
+func TestHelpOfCommand(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "mod", "!help bet", "moderator")
+	said := fake.takeSaid()
+	if len(said) != 1 || !strings.Contains(said[0], "!bet start") || !strings.Contains(said[0], "!bet end") {
+		t.Errorf("got %q, want the syntax of bet and its subcommands", said)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	for name, want := range map[string]string{
+		"bet": "bet",
+		"Bet": "bet",
+		"BET": "bet",
+		"b": "bet",
+		"B": "bet",
+		"commands": "help",
+		"CoMmAnDs": "help",
+	} {
+		if command := findCommand(commands, name); command == nil || command.name != want {
+			t.Errorf("%s finds %v, want %s", name, command, want)
+		}
+	}
+	if command := findCommand(commands, "nosuchcommand"); command != nil {
+		t.Errorf("found %s for an unknown command", command.name)
+	}
+}
+
+func TestMixedCaseAndAliasCommands(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "mod", "!BET START", "moderator")
+	expectTexts(t, fake.takeSaid(), "Betting has started! Place your bets below!")
+	send(channel, "viewer", "!b 15:04")
+	send(channel, "viewer", "!Bet MyBet")
+	expectTexts(t, fake.takeSaid(), "viewer -> Your bet: 15:04")
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The path of the configuration file.
+const ENV_CONFIG_FILE = "FRAMMIEBOT_CONFIG_FILE"
+
+// The configuration file used when none is configured.
+const DEFAULT_CONFIG_FILE = "./config.json"
+
+// The response to messages matching the water trigger.
+const COFFEE_RESPONSE = "☕☕ Coffee is better! peepoCoffee "
+
+// The pattern of messages triggering the coffee response.
+const WATER_TRIGGER = `(?i)w[aā]t[eē]r`
+
+// The greeting posted when a channel is raided.
+const RAID_GREETING = "🎉 Welcome raiders! Thank you {raider} for raiding with {viewers} viewer(s)!"
+
+// The thank-you posted for new subscriptions.
+const SUB_GREETING = "💜 Thank you {user} for subscribing!"
+
+// The thank-you posted for resubscriptions.
+const RESUB_GREETING = "💜 Thank you {user} for resubscribing, {months} months in a row!"
+
+// The thank-you posted for gifted subscriptions.
+const GIFT_GREETING = "🎁 Thank you {gifter} for gifting a subscription to {recipient}!"
+
+// The response to users running a command they are not allowed to run.
+const DENIED_RESPONSE = "You need to be {level} to use {command}."
+
+// A Duration is a time.Duration read from a string such as "5s".
+type Duration struct {
+	time.Duration
+}
+
+// Reads the duration from a JSON string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var err error
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+// RoundDefaults are the options of rounds started on a channel, used when
+// they are not given when starting a round.
+type RoundDefaults struct {
+	// The name of the kind of values bet on.
+	Kind string `json:"kind"`
+	Mode string `json:"mode"`
+	// The tolerance in units of the kind, as given by +/-n.
+	Tolerance int `json:"tolerance"`
+}
+
+// A Config holds all customizable strings and triggers of the bot. Fields
+// omitted from the configuration file keep their built-in defaults.
+type Config struct {
+	Introduction string `json:"introduction"`
+	CoffeeResponse string `json:"coffee_response"`
+	// The pattern of the built-in coffee trigger, which is turned off when
+	// empty. A trigger named coffee then takes its place, including for the
+	// coffee command.
+	WaterTrigger string `json:"water_trigger"`
+	// Further automatic responses to chat messages, such as
+	// [{"pattern": "(?i)^gg$", "response": "GG EZ", "cooldown": "30s"}].
+	// Evaluated after the coffee trigger, in order.
+	Triggers []Trigger `json:"triggers"`
+	Prefix string `json:"prefix"`
+	// How long chat must wait before reusing a command subject to a
+	// cooldown on the same channel.
+	Cooldown Duration `json:"cooldown"`
+	// Posted when a channel is raided. {raider} and {viewers} are replaced
+	// by the name of the raider and their viewer count.
+	RaidGreeting string `json:"raid_greeting"`
+	// Posted for subscriptions. {user} is replaced by the name of the
+	// subscriber, and for resubscriptions {months} by their cumulative
+	// months subscribed.
+	SubGreeting string `json:"sub_greeting"`
+	ResubGreeting string `json:"resub_greeting"`
+	// Posted for gifted subscriptions. {gifter} and {recipient} are replaced
+	// by the names of the gifter and recipient.
+	GiftGreeting string `json:"gift_greeting"`
+	// The announcement of the winners of a round, in which {winners} is
+	// replaced by the list of winners. The default is used when empty.
+	WinnersAnnouncement string `json:"winners_announcement"`
+	// The announcement of a round without winners. The default is used when
+	// empty.
+	NoWinnersAnnouncement string `json:"no_winners_announcement"`
+	// The response to users lacking the permission to run a command.
+	// {level} and {command} are replaced by who may run it and the command.
+	// Users are ignored silently when empty.
+	DeniedResponse string `json:"denied_response"`
+	// The response to users running a command that is on cooldown, such as
+	// "{command} is on cooldown ({seconds}s left).". {command} and {seconds}
+	// are replaced by the command and the seconds until it may be run again.
+	// Users are told at most once per cooldown, and ignored silently when
+	// empty.
+	CooldownResponse string `json:"cooldown_response"`
+	// The number of messages the bot may send per 30 seconds. Twitch allows
+	// more when the bot is moderator in the channel.
+	MessageRate int `json:"message_rate"`
+	// The number of channels joined per 10 seconds when joining many on
+	// startup. Twitch allows 20 for regular accounts.
+	JoinRate int `json:"join_rate"`
+	// Whether to make a message identical to the previous message on the
+	// same channel unique, so Twitch does not drop it.
+	DedupeMessages bool `json:"dedupe_messages"`
+	// How long the winners of the last round can be repeated after it
+	// ended.
+	WinnersExpiry Duration `json:"winners_expiry"`
+	// The maximum number of values in a single bet.
+	MaxSlots int `json:"max_slots"`
+	// The channels the bot may join. All channels are allowed when empty.
+	AllowedChannels []string `json:"allowed_channels"`
+	// The permission level required to run commands by command, such as
+	// {"bet start": "vip"}. Commands not listed keep their default level.
+	Permissions map[string]string `json:"permissions"`
+	// How long after starting a round that was never ended is removed, such
+	// as "24h", refunding its wagers. Rounds never expire when zero, as by
+	// default.
+	MaxRoundAge Duration `json:"max_round_age"`
+	// Whether to tell the channel a round has expired. Off by default.
+	AnnounceExpiry bool `json:"announce_expiry"`
+	// The options of rounds started on a channel by channel, such as
+	// {"frammie": {"mode": "closest"}}.
+	RoundDefaults map[string]RoundDefaults `json:"round_defaults"`
+	// Whether messages starting with a mention of the bot, such as
+	// "@frammiebot help", are commands as well.
+	MentionCommands bool `json:"mention_commands"`
+	// Whether to post the introduction again after reconnecting, on the
+	// channels it was posted on when joining. Only applies when posting the
+	// introduction on joining is enabled.
+	ReintroduceOnReconnect bool `json:"reintroduce_on_reconnect"`
+	// Whether to respond in plain text without emoji, which reads better
+	// with screen readers. Configured texts have their emoji removed.
+	Accessible bool `json:"accessible"`
+	// Whether to leave a channel the bot has been banned from.
+	LeaveWhenBanned bool `json:"leave_when_banned"`
+}
+
+// The configuration currently in effect.
+var config = defaultConfig()
+
+// Guards the configuration in effect while it is replaced. Event handlers
+// hold it for reading, so they see the same configuration throughout.
+var configLock sync.RWMutex
+
+// Returns the built-in configuration.
+func defaultConfig() *Config {
+	return &Config{
+		Introduction: INTRODUCTION,
+		CoffeeResponse: COFFEE_RESPONSE,
+		WaterTrigger: WATER_TRIGGER,
+		Prefix: DEFAULT_PREFIX,
+		Cooldown: Duration{DEFAULT_COOLDOWN},
+		RaidGreeting: RAID_GREETING,
+		SubGreeting: SUB_GREETING,
+		ResubGreeting: RESUB_GREETING,
+		GiftGreeting: GIFT_GREETING,
+		DeniedResponse: DENIED_RESPONSE,
+		MessageRate: DEFAULT_MESSAGE_RATE,
+		JoinRate: DEFAULT_JOIN_RATE,
+		MaxSlots: DEFAULT_MAX_SLOTS,
+		DedupeMessages: true,
+		WinnersExpiry: Duration{DEFAULT_WINNERS_EXPIRY},
+		MentionCommands: true,
+	}
+}
+
+// Reads the configuration file at given path on top of the built-in
+// defaults. A missing file yields the defaults.
+func loadConfig(path string) (*Config, error) {
+	c := defaultConfig()
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return nil, err
+	}
+	return c, c.validate()
+}
+
+// Checks that all fields of the configuration are usable.
+func (c *Config) validate() error {
+	if len(c.Triggers) > MAX_TRIGGERS {
+		return errors.New("at most " + strconv.Itoa(MAX_TRIGGERS) + " triggers may be configured")
+	}
+	if _, err := compileTriggers(c); err != nil {
+		return err
+	}
+	if c.Prefix == "" {
+		return errors.New("prefix must not be empty")
+	}
+	if c.Cooldown.Duration < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+	if c.MessageRate < 1 {
+		return errors.New("message_rate must be positive")
+	}
+	if c.WinnersAnnouncement != "" && !strings.Contains(c.WinnersAnnouncement, "{winners}") {
+		return errors.New("winners_announcement must contain {winners}")
+	}
+	if strings.Contains(c.NoWinnersAnnouncement, "{winners}") {
+		return errors.New("no_winners_announcement can not contain {winners}, as there are none")
+	}
+	if c.JoinRate < 1 {
+		return errors.New("join_rate must be positive")
+	}
+	if c.MaxRoundAge.Duration < 0 {
+		return errors.New("max_round_age must not be negative")
+	}
+	if c.MaxSlots < 1 {
+		return errors.New("max_slots must be positive")
+	}
+	for channel, defaults := range c.RoundDefaults {
+		if defaults.Kind != "" && findKind(defaults.Kind) == nil {
+			return errors.New("invalid round_defaults for " + channel + ": unknown kind " + defaults.Kind)
+		}
+		switch defaults.Mode {
+			case "", MODE_EXACT, MODE_CLOSEST, MODE_PARTIAL:
+			default:
+				return errors.New("invalid round_defaults for " + channel + ": unknown mode " + defaults.Mode)
+		}
+		if defaults.Tolerance < 0 {
+			return errors.New("invalid round_defaults for " + channel + ": tolerance must not be negative")
+		}
+	}
+	if err := validatePermissions(c.Permissions); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Makes given configuration the one in effect.
+func applyConfig(c *Config) {
+	config = c
+	triggers, _ = compileTriggers(c)
+	regex["command"] = commandRegex(c.Prefix)
+}
+
+// Applies the settings given through the environment on top of given
+// configuration.
+func overrideConfig(c *Config) {
+	if prefix, exist := os.LookupEnv(ENV_PREFIX); exist {
+		c.Prefix = prefix
+	}
+	if allowed, exist := os.LookupEnv(ENV_ALLOWED_CHANNELS); exist {
+		c.AllowedChannels = strings.FieldsFunc(allowed, func(r rune) bool { return r == ',' })
+	}
+}
+
+// Reads the configuration file at given path again and makes it the one in
+// effect, logging the settings that changed. The configuration in effect is
+// kept if the file is invalid. The message rate only changes on restart.
+func reloadConfig(path string) {
+	c, err := loadConfig(path)
+	if err != nil {
+		slog.Error("Failed to reload config, keeping the current one", "event", "reload", "file", path, "error", err)
+		return
+	}
+	overrideConfig(c)
+
+	configLock.Lock()
+	changed := changedSettings(config, c)
+	applyConfig(c)
+	configLock.Unlock()
+	slog.Info("Reloaded config", "event", "reload", "file", path, "changed", changed)
+}
+
+// Returns the names of the settings that differ between given
+// configurations.
+func changedSettings(old *Config, new *Config) []string {
+	changed := []string{}
+	o, n := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	for i := 0; i < o.NumField(); i++ {
+		if !reflect.DeepEqual(o.Field(i).Interface(), n.Field(i).Interface()) {
+			changed = append(changed, o.Type().Field(i).Tag.Get("json"))
+		}
+	}
+	return changed
+}
+
+// Whispers the settings in effect on the channel, such as after reloading
+// the configuration. Greetings and other texts are left out for brevity;
+// the configuration holds no secrets.
+func configCommand(message *twitch.PrivateMessage, args []string) {
+	defaults := defaultRoundOptions(message.Channel)
+	settings := []string{
+		"prefix=" + prefixOf(message.Channel),
+		"cooldown=" + config.Cooldown.String(),
+		"water_trigger=" + config.WaterTrigger,
+		"coffee=" + strconv.FormatBool(coffeeEnabled(message.Channel)),
+		"triggers=" + strconv.Itoa(len(config.Triggers)),
+		"subs=" + strconv.FormatBool(subsEnabled(message.Channel)),
+		"message_rate=" + strconv.Itoa(config.MessageRate),
+		"dedupe_messages=" + strconv.FormatBool(config.DedupeMessages),
+		"max_slots=" + strconv.Itoa(config.MaxSlots),
+		"winners_expiry=" + config.WinnersExpiry.String(),
+		"max_round_age=" + config.MaxRoundAge.String(),
+		"round_defaults=" + defaults.kind.name + " " + defaults.mode + " " + TOLERANCE_PREFIX + strconv.Itoa(defaults.tolerance),
+		"mention_commands=" + strconv.FormatBool(config.MentionCommands),
+		"accessible=" + strconv.FormatBool(config.Accessible),
+	}
+	if len(config.Permissions) > 0 {
+		permissions := make([]string, 0, len(config.Permissions))
+		for path, level := range config.Permissions {
+			permissions = append(permissions, path + ":" + level)
+		}
+		sort.Strings(permissions)
+		settings = append(settings, "permissions=" + strings.Join(permissions, ","))
+	}
+	respondPrivately(message, "Settings on " + message.Channel + ": " + strings.Join(settings, " | "))
+}
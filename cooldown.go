@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// The cooldown used when none is configured.
+const DEFAULT_COOLDOWN = 5 * time.Second
+
+// Identifies something subject to a cooldown, such as a command, on a
+// single channel.
+type cooldownKey struct {
+	channel string
+	subject any
+}
+
+// The last invocation of everything subject to a cooldown, per channel.
+var cooldowns = struct {
+	sync.Mutex
+	last map[cooldownKey]time.Time
+}{last: make(map[cooldownKey]time.Time)}
+
+// Reports whether given subject is off cooldown on given channel, and if so
+// restarts its cooldown of given duration.
+func checkCooldown(channel string, subject any, duration time.Duration) bool {
+	return startCooldown(channel, subject, duration) == 0
+}
+
+// Returns how long given subject remains on cooldown of given duration on
+// given channel. If it is off cooldown, returns zero and restarts its
+// cooldown.
+func startCooldown(channel string, subject any, duration time.Duration) time.Duration {
+	key := cooldownKey{channel, subject}
+	now := time.Now()
+
+	cooldowns.Lock()
+	defer cooldowns.Unlock()
+	if last, exist := cooldowns.last[key]; exist && now.Sub(last) < duration {
+		return duration - now.Sub(last)
+	}
+	cooldowns.last[key] = now
+	return 0
+}
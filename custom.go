@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// The maximum number of custom commands per channel.
+const MAX_CUSTOM_COMMANDS = 50
+
+// The maximum length of the response of a custom command, leaving room
+// within the 500 characters Twitch allows per message.
+const MAX_CUSTOM_RESPONSE = 400
+
+// The pattern names of custom commands must match.
+var customNameRegex = regexp.MustCompile(`^[a-z0-9_]{1,25}$`)
+
+// The static responses of the custom commands per channel by name.
+var custom = struct {
+	sync.Mutex
+	commands map[string]map[string]string
+}{commands: make(map[string]map[string]string)}
+
+// Returns the response of the custom command of given name on given channel.
+func customResponse(channel string, name string) (string, bool) {
+	custom.Lock()
+	defer custom.Unlock()
+	response, exist := custom.commands[channel][name]
+	return response, exist
+}
+
+// Returns the names of the custom commands on given channel, sorted.
+func customNames(channel string) []string {
+	custom.Lock()
+	defer custom.Unlock()
+	names := make([]string, 0, len(custom.commands[channel]))
+	for name := range custom.commands[channel] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Runs the custom command on the channel of the message named by the first
+// argument. Returns false if no such command exists.
+func runCustomCommand(message *twitch.PrivateMessage, args []string) bool {
+	name := strings.ToLower(args[0])
+	response, exist := customResponse(message.Channel, name)
+	if !exist { return false }
+	if !authorized(&message.User) && !checkCooldown(message.Channel, "custom " + name, config.Cooldown.Duration) { return true }
+	commandsTotal.Inc("custom")
+	chat.Say(message.Channel, accessibleText(response))
+	return true
+}
+
+// Returns the text of the command in given message following its first
+// skip words, with its punctuation and spacing intact.
+func rawArgs(message *twitch.PrivateMessage, skip int) string {
+	text, ok := commandText(message)
+	if !ok { return "" }
+	s := strings.TrimSpace(text)
+	for i := 0; i < skip; i++ {
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 { return "" }
+		s = strings.TrimSpace(s[end:])
+	}
+	return s
+}
+
+// Adds or replaces a custom command on the channel.
+func addCommand(message *twitch.PrivateMessage, args []string) {
+	response := rawArgs(message, 2)
+	if len(args) < 2 || response == "" {
+		respond(message, "Format: addcommand <name> <response>")
+		return
+	}
+	name := strings.ToLower(args[0])
+	if !customNameRegex.MatchString(name) {
+		respond(message, "Command names may only contain letters, digits and underscores.")
+		return
+	}
+	if findCommand(commands, name) != nil {
+		respond(message, prefixOf(message.Channel) + name + " is a built-in command.")
+		return
+	}
+	if len(response) > MAX_CUSTOM_RESPONSE {
+		respond(message, "Responses may be at most " + strconv.Itoa(MAX_CUSTOM_RESPONSE) + " characters long.")
+		return
+	}
+	// Twitch would run responses starting with / or . as chat commands.
+	if strings.HasPrefix(response, "/") || strings.HasPrefix(response, ".") {
+		respond(message, "Responses may not start with / or .")
+		return
+	}
+
+	custom.Lock()
+	named := custom.commands[message.Channel]
+	if named == nil {
+		named = make(map[string]string)
+		custom.commands[message.Channel] = named
+	}
+	if _, exist := named[name]; !exist && len(named) >= MAX_CUSTOM_COMMANDS {
+		custom.Unlock()
+		respond(message, "This channel already has " + strconv.Itoa(MAX_CUSTOM_COMMANDS) + " custom commands.")
+		return
+	}
+	named[name] = response
+	custom.Unlock()
+	saveState()
+	respond(message, "Added " + prefixOf(message.Channel) + name + ".")
+}
+
+// Removes a custom command from the channel.
+func delCommand(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 1 {
+		respond(message, "Format: delcommand <name>")
+		return
+	}
+	name := strings.ToLower(args[0])
+	custom.Lock()
+	_, exist := custom.commands[message.Channel][name]
+	delete(custom.commands[message.Channel], name)
+	if len(custom.commands[message.Channel]) == 0 {
+		delete(custom.commands, message.Channel)
+	}
+	custom.Unlock()
+
+	if !exist {
+		respond(message, "There is no custom command " + prefixOf(message.Channel) + name + ".")
+		return
+	}
+	saveState()
+	respond(message, "Removed " + prefixOf(message.Channel) + name + ".")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"github.com/gempir/go-twitch-irc/v2"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Enables dry-run mode when set to a non-empty value: messages are read
+// from standard input instead of Twitch, and responses are written to
+// standard output.
+const ENV_DRYRUN = "FRAMMIEBOT_DRYRUN"
+
+// The channel messages are sent to in dry-run mode when none is given.
+const DRYRUN_CHANNEL = "dryrun"
+
+// Feeds every line read from r to the message handler as a message on given
+// channel. Lines are sent by the broadcaster, unless they start with
+// "@name ", in which case they are sent by the regular viewer name.
+func dryRun(r io.Reader, channel string) error {
+	slog.Info("Reading messages from standard input", "event", "dryrun", "channel", channel)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		user := twitch.User{Name: channel, DisplayName: channel, Badges: map[string]int{"broadcaster": 1}}
+		if strings.HasPrefix(line, "@") {
+			name, text, _ := strings.Cut(strings.TrimPrefix(line, "@"), " ")
+			user = twitch.User{Name: strings.ToLower(name), DisplayName: name, Badges: map[string]int{}}
+			line = text
+		}
+		onPrivateMessage(twitch.PrivateMessage{
+			User: user,
+			Type: twitch.PRIVMSG,
+			Message: line,
+			Channel: channel,
+			Time: time.Now(),
+		})
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"github.com/gempir/go-twitch-irc/v2"
+	"strconv"
+	"strings"
+)
+
+// Errors of betting operations. The functions performing the operations
+// return these, leaving it to the command handlers to tell users.
+var (
+	// There is no round on the channel to operate on.
+	ErrNoActiveRound = errors.New("no active round")
+	// The round no longer accepts bets.
+	ErrRoundClosed = errors.New("round closed")
+	// The user may not do what they tried.
+	ErrNotAuthorized = errors.New("not authorized")
+	// A value does not read as a value of the kind of the round. Named for
+	// times, the default kind, but reported for values of every kind.
+	ErrBadTimeFormat = errors.New("bad time format")
+	// The round is open already.
+	ErrRoundOpen = errors.New("round open")
+	// The bet is the same as the bet the user placed before.
+	ErrBetUnchanged = errors.New("bet unchanged")
+	// The user may not change their bet in a locked round.
+	ErrBetLocked = errors.New("bet locked")
+)
+
+// An AmbiguousRoundError reports that several rounds are open, none of which
+// was named.
+type AmbiguousRoundError struct {
+	names []string
+}
+
+// Lists the open rounds.
+func (err *AmbiguousRoundError) Error() string {
+	return "ambiguous round, open rounds are " + strings.Join(err.names, ", ")
+}
+
+// A ValueError reports a value that is not a value of given kind. It is an
+// ErrBadTimeFormat, wrapping the error reading the value.
+type ValueError struct {
+	value string
+	kind *Kind
+	err error
+}
+
+// Describes the value and why it could not be read.
+func (err *ValueError) Error() string {
+	return "invalid " + err.kind.name + " " + err.value + ": " + err.err.Error()
+}
+
+// Returns ErrBadTimeFormat along with the error reading the value.
+func (err *ValueError) Unwrap() []error {
+	return []error{ErrBadTimeFormat, err.err}
+}
+
+// A PermissionError reports that a command may only be run by given kind
+// of user, such as "a moderator". It is an ErrNotAuthorized.
+type PermissionError struct {
+	who string
+}
+
+// Tells who may run the command.
+func (err *PermissionError) Error() string {
+	return "not authorized, only " + err.who + " may"
+}
+
+// Returns ErrNotAuthorized.
+func (err *PermissionError) Unwrap() error {
+	return ErrNotAuthorized
+}
+
+// A WagerError reports a wager exceeding the points balance of the user.
+type WagerError struct {
+	wager int64
+	balance int64
+}
+
+// Tells the wager and the balance.
+func (err *WagerError) Error() string {
+	return "cannot wager " + strconv.FormatInt(err.wager, 10) + " points with a balance of " + strconv.FormatInt(err.balance, 10)
+}
+
+// Tells the sender of given message that their betting operation failed with
+// given error.
+func respondError(message *twitch.PrivateMessage, err error) {
+	var ambiguousErr *AmbiguousRoundError
+	var valueErr *ValueError
+	var wagerErr *WagerError
+	switch {
+		case errors.Is(err, ErrNoActiveRound):
+			respond(message, "There is currently no active bidding!")
+		case errors.As(err, &ambiguousErr):
+			respond(message, "Which round? Open rounds: " + strings.Join(ambiguousErr.names, ", ") + ".")
+		case errors.As(err, &valueErr):
+			reason := valueErr.kind.hint
+			var rangeErr *RangeError
+			var ambiguousValueErr *AmbiguousError
+			if errors.As(err, &rangeErr) {
+				reason = rangeErr.Error() + "; " + reason
+			} else if errors.As(err, &ambiguousValueErr) {
+				reason = ambiguousValueErr.Error()
+			}
+			respond(message, "'" + valueErr.value + "' isn't a valid " + valueErr.kind.name + " (" + reason + ").")
+		case errors.Is(err, ErrRoundClosed):
+			respond(message, "Betting has closed on " + message.Channel + ".")
+		case errors.Is(err, ErrRoundOpen):
+			respond(message, "Betting is already open!")
+		case errors.Is(err, ErrBetUnchanged):
+			respond(message, "You already bet that.")
+		case errors.Is(err, ErrBetLocked):
+			respond(message, "Your bet is locked.")
+		case errors.As(err, &wagerErr):
+			respond(message, "You can not wager " + strconv.FormatInt(wagerErr.wager, 10) + " point(s), you have " + strconv.FormatInt(wagerErr.balance, 10) + ".")
+		default:
+			respond(message, "Something went wrong: " + err.Error())
+	}
+}
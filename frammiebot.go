@@ -1,183 +1,419 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"github.com/gempir/go-twitch-irc/v2"
+	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 const VERSION = "1.1"
 
+// The commit the bot was built from, set at build time with
+// -ldflags "-X main.commit=<commit>".
+var commit string
+
+// When the bot was started.
+var startedAt = time.Now()
+
 // The introduction message shown when the bot joins a channel and
 // on standard output.
 const INTRODUCTION = "frammiebot v"+VERSION+" IN DA HOOS 4Head KEKW ."
 
+// The name of the Twitch account the bot logs in as.
+const ENV_USERNAME = "FRAMMIEBOT_USERNAME"
+
+// The account name used when none is configured.
+const DEFAULT_USERNAME = "frammiebot"
+
+// The user with full control over the bot on every channel.
+const ENV_OWNER = "FRAMMIEBOT_OWNER"
+
+// The owner used when none is configured.
+const DEFAULT_OWNER = "frammie"
+
 // The OAuth token to use for authorization to a Twitch channel.
 const ENV_TOKEN = "TWITCH_OAUTH_TOKEN"
 
+// The path of a file containing the OAuth token, taking precedence over the
+// token in the environment.
+const ENV_TOKEN_FILE = "FRAMMIEBOT_TOKEN_FILE"
+
+// The address of the IRC server to connect to instead of Twitch, such as a
+// local mock server to run the bot against end to end.
+const ENV_IRC_ADDR = "FRAMMIEBOT_IRC_ADDR"
+
+// Connect to the IRC server without TLS when set.
+const ENV_IRC_NO_TLS = "FRAMMIEBOT_IRC_NO_TLS"
+
+// The prefix messages must start with to be treated as a command.
+const ENV_PREFIX = "FRAMMIEBOT_PREFIX"
+
+// The command prefix used when none is configured.
+const DEFAULT_PREFIX = "!"
+
+// How long to wait for the connection to close on shutdown.
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+// The delay before the first reconnection attempt, doubled after every
+// failed attempt up to the maximum.
+const RECONNECT_MIN_BACKOFF = time.Second
+const RECONNECT_MAX_BACKOFF = 30 * time.Second
+
+// How long a connection must stay up for the reconnection delay to reset.
+const RECONNECT_RESET_AFTER = time.Minute
+
+// The connection to Twitch. Only used to manage the connection itself,
+// handlers go through chat instead.
 var client *twitch.Client
 
 // Collection of various compiled regular expressions.
 var regex = map[string]*regexp.Regexp {
-	"command": regexp.MustCompile(`^\!(.*)$`),
-	"message": regexp.MustCompile(`(\w|\:)+`),
-	"water": regexp.MustCompile(`(?i)(w[a|ā]t[e|ē]r)`),
+	"command": commandRegex(DEFAULT_PREFIX),
+	"message": regexp.MustCompile(`(\w|\:|\=|\-|\.|\+\/\-)+`),
 }
 
-// A BettingRound is a single round of betting on a channel.
-type BettingRound struct {
-	closed bool
-	bets map[string][]time.Time
+// Compiles the regular expression matching commands starting with given
+// prefix. The prefix is matched literally.
+func commandRegex(prefix string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(prefix) + `(.*)$`)
 }
 
-// The currently open betting rounds per channel.
-var channelBets = make(map[string]*BettingRound)
+// The user the bot logs in as, resolved on startup.
+var username = DEFAULT_USERNAME
+
+// The user with full control over the bot on every channel, resolved on
+// startup.
+var owner = DEFAULT_OWNER
 
 // Whether or not the given user is allowed to perform a task that requires
 // additional permissions.
 func authorized(user *twitch.User) bool {
-	return user.Badges["broadcaster"] + user.Badges["moderator"] > 0 || user.Name == "frammie"
+	return userLevel(user) >= LEVEL_MOD
 }
 
-// Used to respond to incoming messages using a standard form.
-func respond(message *twitch.PrivateMessage, response string) {
-	client.Say(message.Channel, message.User.DisplayName + " -> " + response)
+// Whether or not the given user may administer the bot itself, such as
+// deciding which channels it is in.
+func admin(user *twitch.User) bool {
+	return user.Name == owner
 }
 
-// Converts given input array of strings to array of time.Time, or if failed,
-// notify the requester and return error.
-func formatTimes(times []string, message *twitch.PrivateMessage) ([]time.Time, error) {
-	ft := make([]time.Time, len(times))
-	for i, t := range times {
-		pt, err := time.Parse("15:04", t)
-		if err != nil {
-			respond(message, "Could not read your time(s).")
-			return nil, err
-		} else {
-			ft[i] = pt
-		}
+// Used to respond to incoming messages using a standard form. Whispered
+// messages are responded to with a whisper, and commands run through the
+// API have their responses returned to the API client.
+func respond(message *twitch.PrivateMessage, response string) {
+	if captureReply(message, response) { return }
+	if private(message) {
+		chat.Whisper(message.User.Name, response)
+		return
 	}
-	return ft, nil
+	chat.Say(message.Channel, message.User.DisplayName + " -> " + response)
 }
 
-// Checks if on the channel the message originated from there is currently
-// a bidding round going on.
-func checkActiveBidding(message *twitch.PrivateMessage) bool {
-	if _, exist := channelBets[message.Channel]; exist == false {
-		respond(message, "There is currently no active bidding!")
-		return false
-	}
-	return true
+// Responds to given message with a whisper, even if the message was sent in
+// chat. Used for responses meant for the sender only.
+func respondPrivately(message *twitch.PrivateMessage, response string) {
+	if captureReply(message, response) { return }
+	chat.Whisper(message.User.Name, response)
 }
 
 // Primary message event handler used for parsing commands related to all
 // fields of operation of this bot.
 func onPrivateMessage(message twitch.PrivateMessage) {
+	messagesTotal.Inc("")
+	if debugMessages {
+		slog.Debug("Received message", "event", "message", "channel", message.Channel, "user", message.User.Name, "text", message.Message)
+	}
+	configLock.RLock()
+	defer configLock.RUnlock()
 
-	if regex["water"].MatchString(message.Message) {
-		client.Say(message.Channel, "☕☕ Coffee is better! peepoCoffee ")
-	}
-
-	split := regex["command"].FindStringSubmatch(message.Message)
-	if len(split) > 1 {
-		parts := regex["message"].FindAllString(split[1], -1)
-
-		switch parts[0] {
-			case "bet":
-				if len(parts) < 2 { return }
-
-				switch parts[1] {
-					// Starts a new betting round
-					case "start":
-						if !authorized(&message.User) { return }
-						client.Say(message.Channel, "Betting has started! Place your bets below!")
-						channelBets[message.Channel] = &BettingRound{bets: make(map[string][]time.Time)}
-					// Closes an existing betting round
-					case "close":
-						if !authorized(&message.User) { return }
-						if !checkActiveBidding(&message) { return }
-						channelBets[message.Channel].closed = true
-						client.Say(message.Channel, "Betting has closed! Everyone, good luck!")
-					// Ends a betting round
-					case "end":
-						if !authorized(&message.User) { return }
-						if !checkActiveBidding(&message) { return }
-						if len(parts) < 3 {
-							respond(&message, "Format: bet end [time...]")
-							return
-						}
-
-						results, err := formatTimes(parts[2:], &message)
-						if err != nil { return }
-
-						// Determine winners
-						winners := make([]string, 0, 5)
-						determine:
-						for user, times := range channelBets[message.Channel].bets {
-							for i := 0; i < len(results); i++ {
-								if i > len(times)-1 || !times[i].Equal(results[i]) {
-									continue determine
-								}
-							}
-							// Winner
-							winners = append(winners, user)
-						}
-
-						if len(winners) > 0 {
-							winMessage := "🎉 Congratulations to following winner(s): "
-							for _, winner := range winners {
-								winMessage += "🥳 - " + winner + " "
-							}
-							client.Say(message.Channel, winMessage)
-						} else {
-							client.Say(message.Channel, "✨ Unfortunately no winners this time, good luck on the next betting round!")
-						}
-
-						delete(channelBets, message.Channel)
-					// By default, handle !bet prefix messages as actual bets.
-					default:
-						if !checkActiveBidding(&message) { return }
-						if channelBets[message.Channel].closed { return }
-
-						times, err := formatTimes(parts[1:], &message)
-						if err != nil { return }
-
-						// Record/update bet
-						channelBets[message.Channel].bets[message.User.DisplayName] = times
-						log.Println(message.User.DisplayName + " betted")
-				}
+	runTriggers(&message)
+
+	if text, ok := commandText(&message); ok {
+		parts := regex["message"].FindAllString(text, -1)
+		// A bare prefix, or one followed by punctuation only, names no
+		// command.
+		if len(parts) == 0 { return }
+		if !runCommand(commands, &message, parts) {
+			runCustomCommand(&message, parts)
 		}
 	}
 }
 
+// Keeps the client connected to the joined channels, reconnecting with exponential
+// backoff whenever the connection drops. Only returns once the client was
+// disconnected on purpose or failed to authenticate.
+func connect() error {
+	backoff := RECONNECT_MIN_BACKOFF
+	for {
+		// Joining is a no-op for channels the client still knows about.
+		client.Join(joinedChannels()...)
+
+		started := time.Now()
+		err := client.Connect()
+		// Includes the time taken to connect, unless the connection never
+		// got that far.
+		var lasted time.Duration
+		if connected.Swap(false) {
+			lasted = time.Since(started).Round(time.Second)
+		}
+		if err == twitch.ErrClientDisconnected {
+			slog.Info("Disconnected", "event", "disconnect", "channels", joinedChannels(), "connected_for", lasted)
+			return err
+		}
+		if err == twitch.ErrLoginAuthenticationFailed {
+			return err
+		}
+
+		if time.Since(started) > RECONNECT_RESET_AFTER {
+			backoff = RECONNECT_MIN_BACKOFF
+		}
+		slog.Warn("Connection lost", "event", "disconnect", "error", err, "channels", joinedChannels(), "connected_for", lasted, "backoff", backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > RECONNECT_MAX_BACKOFF {
+			backoff = RECONNECT_MAX_BACKOFF
+		}
+		slog.Info("Reconnecting", "event", "reconnect")
+	}
+}
+
+// Registers the handlers of the messages and connects of the client.
+func registerHandlers() {
+	client.OnPrivateMessage(onPrivateMessage)
+	client.OnUserNoticeMessage(onUserNoticeMessage)
+	client.OnNoticeMessage(onNoticeMessage)
+	client.OnClearChatMessage(onClearChatMessage)
+	client.OnWhisperMessage(onWhisperMessage)
+	client.OnRoomStateMessage(onRoomStateMessage)
+	client.OnUserStateMessage(onUserStateMessage)
+	client.OnConnect(func() {
+		connected.Store(true)
+		// The client reconnects by itself after some failures, which are
+		// only noticed as a later connect, and connect reconnects after
+		// the others.
+		if connectedBefore.Swap(true) {
+			slog.Info("Reconnected", "event", "reconnect", "channels", joinedChannels())
+			rejoinStaggered()
+			// The introduction is not repeated on flaky connections unless
+			// configured.
+			configLock.RLock()
+			again := config.ReintroduceOnReconnect
+			configLock.RUnlock()
+			if again && os.Getenv(ENV_ANNOUNCE_JOIN) != "" {
+				go reintroduce(ANNOUNCE_DELAY)
+			}
+			return
+		}
+		slog.Info("Connected", "event", "connect", "channels", joinedChannels())
+	})
+}
+
 func main() {
-	// Retrieve OAuth token from operating system environment.
-	token, exist := os.LookupEnv(ENV_TOKEN)
-	if !exist {
-		log.Fatal("Failed to find token in environment variable "+ENV_TOKEN)
+	if err := setupLogging(); err != nil {
+		fatal(err.Error())
 	}
 
-	client = twitch.NewClient("frammiebot", "oauth:"+token)
+	dryrun := os.Getenv(ENV_DRYRUN) != ""
 
-	// Validate arguments.
-	if len(os.Args) < 2 {
-		log.Fatal("No channels to join specified. Format: frammiebot [channel...]")
+	// Retrieve OAuth token from a file or the operating system environment.
+	token := os.Getenv(ENV_TOKEN)
+	if path, exist := os.LookupEnv(ENV_TOKEN_FILE); exist {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatal("Failed to read token file", "file", path, "error", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	// Tokens are commonly copied along with their prefix.
+	token = strings.TrimPrefix(token, "oauth:")
+	if token == "" && !dryrun {
+		fatal("Failed to find token, set "+ENV_TOKEN_FILE+" or "+ENV_TOKEN)
 	}
 
-	log.Println(INTRODUCTION)
+	if name, exist := os.LookupEnv(ENV_USERNAME); exist && name != "" {
+		username = strings.ToLower(name)
+	}
+	if name, exist := os.LookupEnv(ENV_OWNER); exist && name != "" {
+		owner = strings.ToLower(name)
+	}
 
-	// Join channel names as given as arguments.
-	for _, channel := range os.Args[1:] {
-		client.Join(channel)
-		client.Say(channel, INTRODUCTION)
+	client = twitch.NewClient(username, "oauth:"+token)
+	if addr, exist := os.LookupEnv(ENV_IRC_ADDR); exist {
+		client.IrcAddress = addr
 	}
+	if os.Getenv(ENV_IRC_NO_TLS) != "" {
+		client.TLS = false
+	}
+	chat = client
 
-	// Register handlers
-	client.OnPrivateMessage(onPrivateMessage);
+	// Validate arguments, adding the channels given through the environment.
+	channels := mergeChannels(os.Args[1:], strings.Split(os.Getenv(ENV_CHANNELS), ","))
+	if dryrun {
+		chat = &WriterChat{os.Stdout}
+		if len(channels) < 1 {
+			channels = []string{DRYRUN_CHANNEL}
+		}
+	} else if len(channels) < 1 {
+		fatal("No channels to join specified. Format: frammiebot [channel...], or set "+ENV_CHANNELS)
+	}
 
-	err := client.Connect()
+	// Load customizations, the prefix from the environment taking precedence.
+	configFile := DEFAULT_CONFIG_FILE
+	if path, exist := os.LookupEnv(ENV_CONFIG_FILE); exist {
+		configFile = path
+	}
+	c, err := loadConfig(configFile)
 	if err != nil {
-		log.Fatal(err.Error())
+		fatal("Failed to load config", "file", configFile, "error", err)
+	}
+	if prefix, exist := os.LookupEnv(ENV_PREFIX); exist && prefix == "" {
+		fatal("Empty command prefix in environment variable "+ENV_PREFIX)
+	}
+	overrideConfig(c)
+	applyConfig(c)
+	if !dryrun {
+		chat = newRateLimitedChat(client, config.MessageRate)
+	}
+	chat = &SplittingChat{chat}
+
+	slog.Info(config.Introduction, "event", "startup", "version", VERSION, "commit", commit)
+
+	if size, exist := os.LookupEnv(ENV_LEADERBOARD_SIZE); exist {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			fatal("Invalid leaderboard size in environment variable "+ENV_LEADERBOARD_SIZE)
+		}
+		leaderboardSize = n
+	}
+
+	// Restore betting rounds and statistics from a previous run. Dry runs
+	// only use state when a file is given explicitly.
+	if dryrun {
+		stateFile = ""
+	}
+	if path, exist := os.LookupEnv(ENV_STATE_FILE); exist {
+		stateFile = path
+	}
+	if err := loadState(); err != nil {
+		fatal("Failed to load state", "file", stateFile, "error", err)
+	}
+
+	// Join channel names as given as arguments.
+	var allowed []string
+	for _, channel := range channels {
+		if !allowedChannel(channel) {
+			slog.Warn("Skipping channel that is not allowed", "event", "join", "channel", channel)
+			continue
+		}
+		allowed = append(allowed, channel)
+	}
+	announceJoin := os.Getenv(ENV_ANNOUNCE_JOIN) != ""
+	if dryrun {
+		var newlyJoined []string
+		for _, channel := range allowed {
+			if joinChannel(channel) {
+				newlyJoined = append(newlyJoined, channel)
+			}
+		}
+		if announceJoin {
+			announce(newlyJoined, 0)
+		}
+	} else {
+		joinStaggered(allowed, announceJoin)
+	}
+
+	if dir, exist := os.LookupEnv(ENV_EXPORT_DIR); exist {
+		exportDir = dir
+	}
+
+	if path, exist := os.LookupEnv(ENV_AUDIT_FILE); exist {
+		if err := openAudit(path); err != nil {
+			fatal("Failed to open audit log", "file", path, "error", err)
+		}
+		defer closeAudit()
+	}
+
+	if addr, exist := os.LookupEnv(ENV_METRICS_ADDR); exist {
+		serveMetrics(addr)
+	}
+
+	if dryrun {
+		if err := dryRun(os.Stdin, normalizeChannel(channels[0])); err != nil {
+			fatal("Failed to read standard input", "event", "dryrun", "error", err)
+		}
+		stopTimers()
+		saveState()
+		return
+	}
+
+	go expireRounds()
+
+	registerHandlers()
+
+	var health *http.Server
+	if addr, exist := os.LookupEnv(ENV_HEALTH_ADDR); exist {
+		health = serveHealth(addr)
+	}
+	var api *http.Server
+	if addr, exist := os.LookupEnv(ENV_API_ADDR); exist {
+		if apiToken = os.Getenv(ENV_API_TOKEN); apiToken == "" {
+			fatal("Failed to find API token in environment variable "+ENV_API_TOKEN)
+		}
+		api = serveAPI(addr)
+	}
+
+	if value, exist := os.LookupEnv(ENV_TOKEN_CHECK_INTERVAL); exist {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Minute {
+			fatal("Invalid token check interval in environment variable "+ENV_TOKEN_CHECK_INTERVAL)
+		}
+		go watchToken(token, interval)
+	}
+
+	// Connect in the background so we can listen for termination signals.
+	done := make(chan error, 1)
+	go func() {
+		done <- connect()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	// Reload the configuration on SIGHUP, as is common for daemons.
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+
+	for {
+		select {
+			case <-reloads:
+				reloadConfig(configFile)
+			case err := <-done:
+				saveState()
+				fatal("Connection closed", "event", "disconnect", "error", err)
+			case sig := <-signals:
+				slog.Info("Shutting down", "event", "shutdown", "signal", sig.String())
+				if err := client.Disconnect(); err == nil {
+					select {
+						case <-done:
+						case <-time.After(SHUTDOWN_TIMEOUT):
+							slog.Warn("Timed out waiting for connection to close", "event", "shutdown")
+					}
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+				stopServer(ctx, health)
+				stopServer(ctx, api)
+				cancel()
+				stopTimers()
+				saveState()
+				slog.Info("Shut down cleanly", "event", "shutdown")
+				return
+		}
 	}
 }
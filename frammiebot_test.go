@@ -0,0 +1,177 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Runs the tests with the built-in configuration, keeping state in memory
+// only and discarding the log.
+func TestMain(m *testing.M) {
+	stateFile = ""
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	applyConfig(defaultConfig())
+	os.Exit(m.Run())
+}
+
+// Returns a channel of its own for given test, so tests share no rounds,
+// cooldowns, statistics or points. Everything kept for the channel is
+// forgotten once the test ends, so tests can be run repeatedly.
+func testChannel(t *testing.T) string {
+	channel := strings.ToLower(strings.NewReplacer("/", "_", "#", "_").Replace(t.Name()))
+	t.Cleanup(func() { forgetChannel(channel) })
+	return channel
+}
+
+// Removes the rounds, cooldowns, statistics, points and results of given
+// channel.
+func forgetChannel(channel string) {
+	for _, round := range allRounds() {
+		if round.channel == channel {
+			round.Lock()
+			round.stopTimers()
+			round.Unlock()
+		}
+	}
+	channelBets.Lock()
+	delete(channelBets.rounds, channel)
+	channelBets.Unlock()
+
+	cooldowns.Lock()
+	for key := range cooldowns.last {
+		if key.channel == channel {
+			delete(cooldowns.last, key)
+		}
+	}
+	cooldowns.Unlock()
+
+	stats.Lock()
+	delete(stats.users, channel)
+	stats.Unlock()
+	points.Lock()
+	delete(points.balances, channel)
+	points.Unlock()
+	lastResults.Lock()
+	delete(lastResults.results, channel)
+	delete(lastResults.history, channel)
+	lastResults.Unlock()
+}
+
+// Returns a chat message of given text on given channel, sent by the user
+// of given name having given badges.
+func chatMessage(channel string, user string, text string, badges ...string) twitch.PrivateMessage {
+	userBadges := make(map[string]int, len(badges))
+	for _, badge := range badges {
+		userBadges[badge] = 1
+	}
+	return twitch.PrivateMessage{
+		User: twitch.User{Name: strings.ToLower(user), DisplayName: user, Badges: userBadges},
+		Type: twitch.PRIVMSG,
+		Message: text,
+		Channel: channel,
+		Time: time.Now(),
+	}
+}
+
+// Handles a chat message of given text on given channel, sent by the user of
+// given name having given badges.
+func send(channel string, user string, text string, badges ...string) {
+	onPrivateMessage(chatMessage(channel, user, text, badges...))
+}
+
+func TestPing(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "viewer", "!ping")
+	said := fake.takeSaid()
+	if len(said) != 1 || !strings.HasPrefix(said[0], "viewer -> pong (") {
+		t.Fatalf("got %q, want a pong with the delay", said)
+	}
+}
+
+func TestCommandsRespondOnTheirChannel(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "viewer", "!version")
+	if len(fake.said) != 1 || fake.said[0].to != channel {
+		t.Fatalf("got %+v, want a single response on %s", fake.said, channel)
+	}
+	expectTexts(t, fake.takeSaid(), "viewer -> frammiebot v" + VERSION)
+}
+
+func TestCooldownSilencesViewers(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	send(channel, "viewer", "!roll 1")
+	send(channel, "viewer", "!roll 1")
+	expectTexts(t, fake.takeSaid(), "viewer -> A die has 2 to 1000000 sides, such as !roll 20.")
+
+	// Moderators are not subject to cooldowns.
+	send(channel, "mod", "!roll 1", "moderator")
+	expectTexts(t, fake.takeSaid(), "mod -> A die has 2 to 1000000 sides, such as !roll 20.")
+}
+
+func TestWhisperedBetIsAnsweredPrivately(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	joinChannel(channel)
+	t.Cleanup(func() { leaveChannel(channel) })
+
+	send(channel, "mod", "!bet start", "moderator")
+	fake.takeSaid()
+	onWhisperMessage(twitch.WhisperMessage{User: twitch.User{Name: "viewer", DisplayName: "viewer"}, Message: "bet " + channel + " 15:04"})
+	expectTexts(t, fake.takeSaid())
+	expectTexts(t, fake.takeWhispered(), "Your bet of 15:04 on " + channel + " has been recorded.")
+}
+
+func TestMultiCharacterPrefix(t *testing.T) {
+	regex := commandRegex("frammie ")
+	for text, want := range map[string]string{"frammie help": "help", "frammie bet 15:04": "bet 15:04", "frammiehelp": "", "!help": ""} {
+		got := ""
+		if split := regex.FindStringSubmatch(text); len(split) > 1 {
+			got = split[1]
+		}
+		if got != want {
+			t.Errorf("%q reads as command %q, want %q", text, got, want)
+		}
+	}
+	// Characters special in regular expressions are matched literally.
+	if regex := commandRegex("$."); regex.MatchString("$xhelp") || !regex.MatchString("$.help") {
+		t.Error("prefix $. is not matched literally")
+	}
+}
+
+func TestChannelPrefix(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	prefixes.Lock()
+	setPrefix(channel, "frammie ")
+	prefixes.Unlock()
+	t.Cleanup(func() {
+		prefixes.Lock()
+		setPrefix(channel, "")
+		prefixes.Unlock()
+	})
+
+	send(channel, "viewer", "!version")
+	send(channel, "viewer", "frammie version")
+	expectTexts(t, fake.takeSaid(), "viewer -> frammiebot v" + VERSION)
+}
+
+func TestBarePrefix(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	for _, text := range []string{"!", "!!", "!?!", "! ", "!  ...", "@" + username, "@" + username + ", ?"} {
+		send(channel, "viewer", text)
+	}
+	expectTexts(t, fake.takeSaid())
+}
@@ -1,6 +1,6 @@
 module github.com/dwknippers/frammiebot
 
-go 1.14
+go 1.21
 
 require (
 	github.com/gempir/go-twitch-irc/v2 v2.3.1
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+)
+
+// The address to serve the health check on, such as ":8081". The health
+// check is not served when unset.
+const ENV_HEALTH_ADDR = "FRAMMIEBOT_HEALTH_ADDR"
+
+// Whether the bot is currently connected to Twitch.
+var connected atomic.Bool
+
+// Whether the bot has connected to Twitch since startup, so later connects
+// are reconnects.
+var connectedBefore atomic.Bool
+
+// Responds with 200 OK while connected to Twitch, and 503 otherwise.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !connected.Load() {
+		http.Error(w, "not connected", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// Serves the health check on given address in the background. Returns the
+// server so it can be shut down.
+func serveHealth(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthHandler)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		slog.Info("Serving health check", "event", "health", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Failed to serve health check", "event", "health", "addr", addr, "error", err)
+		}
+	}()
+	return server
+}
+
+// Stops given HTTP server, if it is served.
+func stopServer(ctx context.Context, server *http.Server) {
+	if server == nil { return }
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Failed to stop HTTP server", "event", "shutdown", "addr", server.Addr, "error", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/gempir/go-twitch-irc/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A mockIRC is a Twitch IRC server accepting a single client, so the bot can
+// be run end to end, from the lines it reads to the lines it writes.
+type mockIRC struct {
+	listener net.Listener
+	// The connection of the client once accepted.
+	conn chan net.Conn
+	// The lines written by the client, except pings.
+	lines chan string
+	// Serializes writing lines to the client.
+	mutex sync.Mutex
+	// The number of messages sent to the client, for unique ids.
+	sent int
+}
+
+// Starts a mock IRC server for given test on a free local port.
+func startMockIRC(t *testing.T) *mockIRC {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &mockIRC{listener: listener, conn: make(chan net.Conn, 1), lines: make(chan string, 1000)}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+// Accepts the client, welcomes it and reads its lines, answering pings.
+func (s *mockIRC) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil { return }
+	defer conn.Close()
+	s.conn <- conn
+	s.write(":tmi.twitch.tv 001 " + username + " :Welcome, GLHF!")
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "PING") {
+			s.write(":tmi.twitch.tv PONG tmi.twitch.tv " + strings.TrimPrefix(line, "PING "))
+			continue
+		}
+		s.lines <- line
+	}
+	close(s.lines)
+}
+
+// Writes given line to the client.
+func (s *mockIRC) write(line string) {
+	conn := <-s.conn
+	s.conn <- conn
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	conn.Write([]byte(line + "\r\n"))
+}
+
+// Sends a chat message of given text on given channel to the client, sent
+// by the user of given name having given badges.
+func (s *mockIRC) privmsg(channel string, user string, text string, badges ...string) {
+	s.mutex.Lock()
+	s.sent++
+	id := s.sent
+	s.mutex.Unlock()
+	versions := make([]string, len(badges))
+	for i, badge := range badges {
+		versions[i] = badge + "/1"
+	}
+	s.write(fmt.Sprintf("@badge-info=;badges=%s;color=;display-name=%s;emotes=;id=%d;mod=0;room-id=1;subscriber=0;tmi-sent-ts=%d;turbo=0;user-id=%d;user-type= :%s!%s@%s.tmi.twitch.tv PRIVMSG #%s :%s",
+		strings.Join(versions, ","), user, id, time.Now().UnixMilli(), id, user, user, user, channel, text))
+}
+
+// Returns the next line written by the client starting with given prefix,
+// skipping the others. Fails given test if none is written in time.
+func (s *mockIRC) next(t *testing.T, prefix string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+			case line, open := <-s.lines:
+				if !open {
+					t.Fatalf("connection closed waiting for %q", prefix)
+				}
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", prefix)
+		}
+	}
+}
+
+// Fails given test unless the client says the expected messages on given
+// channel, in order.
+func (s *mockIRC) expectSaid(t *testing.T, channel string, want ...string) {
+	t.Helper()
+	for _, text := range want {
+		if line := s.next(t, "PRIVMSG #" + channel + " :"); line != "PRIVMSG #" + channel + " :" + text {
+			t.Errorf("said %q, want %q", strings.TrimPrefix(line, "PRIVMSG #" + channel + " :"), text)
+		}
+	}
+}
+
+// Connects the bot, wired as by main, to a mock IRC server on a channel of
+// its own for the duration of given test. Returns the server and channel.
+func connectMockIRC(t *testing.T) (*mockIRC, string) {
+	server := startMockIRC(t)
+	channel := testChannel(t)
+	previousClient, previousChat := client, chat
+	client = twitch.NewClient(username, "oauth:test")
+	client.IrcAddress = server.listener.Addr().String()
+	client.TLS = false
+	registerHandlers()
+	chat = &SplittingChat{newRateLimitedChat(client, DEFAULT_MESSAGE_RATE)}
+	joinChannel(channel)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Connect()
+	}()
+	t.Cleanup(func() {
+		leaveChannel(channel)
+		client.Disconnect()
+		<-done
+		client, chat = previousClient, previousChat
+		connected.Store(false)
+		connectedBefore.Store(false)
+	})
+	server.next(t, "JOIN #" + channel)
+	return server, channel
+}
+
+func TestScriptedRoundOverIRC(t *testing.T) {
+	server, channel := connectMockIRC(t)
+
+	server.privmsg(channel, "mod", "!bet start closest", "moderator")
+	server.privmsg(channel, "alice", "!bet 15:04")
+	server.privmsg(channel, "bob", "!bet 15:10")
+	server.privmsg(channel, "mod", "!bet status", "moderator")
+	server.privmsg(channel, "mod", "!bet close", "moderator")
+	server.privmsg(channel, "carol", "!bet 15:05")
+	server.privmsg(channel, "mod", "!bet end 15:05", "moderator")
+	server.privmsg(channel, "mod", "!bet status", "moderator")
+
+	// Bets are recorded silently, so every line answers a moderator.
+	server.expectSaid(t, channel,
+		"Betting has started! Closest guess wins, place your bets below!",
+		"mod -> Betting is open (closest mode) with 2 participant(s).",
+		"Betting has closed! 2 bet(s) locked in. Everyone, good luck!",
+		"🎉 Congratulations to following winner(s): 🥳 - alice (off by 1m0s)",
+		"mod -> There is currently no active bidding!",
+	)
+}
+
+// Bets arriving at once from many connections to Twitch must all be
+// recorded. Run with -race.
+func TestConcurrentBetsOverIRC(t *testing.T) {
+	server, channel := connectMockIRC(t)
+	const bettors = 50
+
+	server.privmsg(channel, "mod", "!bet start", "moderator")
+	server.expectSaid(t, channel, "Betting has started! Place your bets below!")
+	var wg sync.WaitGroup
+	for i := 0; i < bettors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			server.privmsg(channel, "user" + strconv.Itoa(i), "!bet 15:" + strconv.Itoa(10 + i))
+		}(i)
+	}
+	wg.Wait()
+	server.privmsg(channel, "mod", "!bet status", "moderator")
+	server.privmsg(channel, "mod", "!bet end 15:10", "moderator")
+	server.expectSaid(t, channel,
+		"mod -> Betting is open (exact mode) with " + strconv.Itoa(bettors) + " participant(s).",
+		"🎉 Congratulations to following winner(s): 🥳 - user0",
+	)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The number of minutes durations must stay below.
+const MAX_DURATION_MINUTES = 1000
+
+// The largest number that can be bet on in a round of numbers. Keeps the
+// summed distances of closest mode from overflowing.
+const MAX_NUMBER = 1000000000000
+
+// A Kind is a type of value that can be bet on in a betting round.
+type Kind struct {
+	name string
+	// What values of this kind are called in messages to users.
+	noun string
+	// How values of this kind are written, for usage messages.
+	usage string
+	// How to write values of this kind, told to users giving invalid values.
+	hint string
+	// Reads the value and precision of a guess of this kind.
+	read func(s string) (Guess, error)
+	// Formats a value of this kind as it was given.
+	format func(guess Guess) string
+	// The distance of one unit of tolerance given when ending a round.
+	toleranceUnit int64
+	// The distance counted for every result a user did not place a bet for
+	// in closest mode. Larger than any distance between two values.
+	penalty int64
+	// The values that may be bet on, for kinds of a fixed set of options.
+	options []string
+	// The time one unit of value stands for, for kinds of times. Zero for
+	// kinds of other values.
+	unit time.Duration
+}
+
+// A RangeError reports a value that is written correctly, but outside of
+// the values it may take.
+type RangeError struct {
+	// What is out of range, such as "hour".
+	what string
+}
+
+// Describes what is out of range.
+func (err *RangeError) Error() string {
+	return err.what + " out of range"
+}
+
+// An AmbiguousError reports a value that could have been meant in more than
+// one way, such as a time written without a colon.
+type AmbiguousError struct {
+	// The values that may have been meant, if any.
+	readings []string
+}
+
+// Describes the ambiguity, suggesting how to write the value instead.
+func (err *AmbiguousError) Error() string {
+	if len(err.readings) == 0 {
+		return "ambiguous, use a colon"
+	}
+	return "ambiguous, use a colon such as " + strings.Join(err.readings, " or ")
+}
+
+// A Guess is a single value as bet or given as result, remembering the
+// precision it was given in.
+type Guess struct {
+	kind *Kind
+	value int64
+	precision int64
+}
+
+// Formats the guess as it was given.
+func (guess Guess) String() string {
+	return guess.kind.format(guess)
+}
+
+// Betting on the time of day something happens. The value of a guess is the
+// number of seconds since midnight.
+var timeKind = &Kind{
+	name: "time",
+	noun: "time(s)",
+	usage: "HH:MM",
+	hint: "use HH:MM, 00–23",
+	read: parseTime,
+	format: formatTime,
+	toleranceUnit: 60,
+	penalty: 24 * 60 * 60,
+	unit: time.Second,
+}
+
+// Betting on a whole number, such as a score.
+var numberKind = &Kind{
+	name: "number",
+	noun: "number(s)",
+	usage: "N",
+	hint: "use a whole number",
+	read: parseNumber,
+	format: func(guess Guess) string {
+		return strconv.FormatInt(guess.value, 10)
+	},
+	toleranceUnit: 1,
+	penalty: 2 * MAX_NUMBER + 1,
+}
+
+// Betting on a duration such as a race or lap time. The value of a guess is
+// the number of milliseconds.
+var durationKind = &Kind{
+	name: "duration",
+	noun: "duration(s)",
+	usage: "M:SS.t",
+	hint: "use M:SS with optional fractions of a second, such as 1:23.4",
+	read: parseDuration,
+	format: formatDuration,
+	toleranceUnit: 1000,
+	penalty: MAX_DURATION_MINUTES * 60 * 1000,
+	unit: time.Millisecond,
+}
+
+// The name of kinds betting on one of a set of options.
+const OPTION_KIND = "option"
+
+// Returns a kind betting on one of given options, such as the winner of a
+// match. The value of a guess is the index of its option.
+func optionKind(options []string) *Kind {
+	kind := &Kind{
+		name: OPTION_KIND,
+		noun: "option(s)",
+		usage: strings.Join(options, "|"),
+		hint: "use one of " + strings.Join(options, ", "),
+		format: func(guess Guess) string {
+			return options[guess.value]
+		},
+		// Options are either right or wrong, so there is no tolerance.
+		toleranceUnit: 0,
+		penalty: 1,
+		options: options,
+	}
+	kind.read = func(s string) (Guess, error) {
+		for i, option := range options {
+			if strings.EqualFold(s, option) {
+				return Guess{value: int64(i), precision: 1}, nil
+			}
+		}
+		return Guess{}, errors.New("unknown option")
+	}
+	return kind
+}
+
+// All kinds of values that can be bet on, the first being the default.
+var kinds = []*Kind{timeKind, numberKind, durationKind}
+
+// Reads a guess of this kind.
+func (kind *Kind) parse(s string) (Guess, error) {
+	guess, err := kind.read(s)
+	guess.kind = kind
+	return guess, err
+}
+
+// Returns the kind with given name, or nil if there is none.
+func findKind(name string) *Kind {
+	for _, kind := range kinds {
+		if kind.name == name {
+			return kind
+		}
+	}
+	return nil
+}
+
+// The layouts times are read in, tried in order, along with the precision
+// in seconds of the time read. Times are formatted in the first layout of
+// their precision.
+var timeLayouts = []struct {
+	layout string
+	precision int64
+}{
+	{"15:04:05", 1},
+	{"15:04", 60},
+	{"3:04:05PM", 1},
+	{"3:04PM", 60},
+}
+
+// Rewrites the common ways of writing a time without colons into a supported
+// layout: dots as in 15.04 become colons, and four or six digits as in 1504
+// are split into hours, minutes and seconds. Three digits are ambiguous, 154
+// being either 1:54 or 15:4, and yield an AmbiguousError.
+// Other times are returned unchanged.
+func normalizeTime(s string) (string, error) {
+	if !strings.Contains(s, ":") {
+		s = strings.ReplaceAll(s, ".", ":")
+	}
+	digits := strings.TrimSuffix(strings.TrimSuffix(s, "AM"), "PM")
+	suffix := s[len(digits):]
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return s, nil
+	}
+	switch len(digits) {
+		case 4:
+			return digits[:2] + ":" + digits[2:] + suffix, nil
+		case 6:
+			return digits[:2] + ":" + digits[2:4] + ":" + digits[4:] + suffix, nil
+		case 3:
+			var readings []string
+			for _, reading := range []string{digits[:1] + ":" + digits[1:], digits[:2] + ":0" + digits[2:]} {
+				if _, err := parseTime(reading + suffix); err == nil {
+					readings = append(readings, reading + suffix)
+				}
+			}
+			return s, &AmbiguousError{readings}
+	}
+	return s, nil
+}
+
+// Reads a time of day in any of the supported layouts, or written without
+// colons as understood by normalizeTime. The AM/PM suffix of 12-hour times
+// is read regardless of case. Times in a supported layout but with a part
+// out of range, such as 25:99, yield a RangeError.
+func parseTime(s string) (Guess, error) {
+	s, err := normalizeTime(strings.ToUpper(s))
+	if err != nil {
+		return Guess{}, err
+	}
+	var rangeErr error
+	for _, l := range timeLayouts {
+		var t time.Time
+		if t, err = time.Parse(l.layout, s); err == nil {
+			seconds := int64(t.Hour() * 3600 + t.Minute() * 60 + t.Second())
+			return Guess{value: seconds, precision: l.precision}, nil
+		}
+		var parseErr *time.ParseError
+		if rangeErr == nil && errors.As(err, &parseErr) && strings.HasSuffix(parseErr.Message, " out of range") {
+			what := strings.TrimSuffix(strings.TrimPrefix(parseErr.Message, ": "), " out of range")
+			rangeErr = &RangeError{what}
+		}
+	}
+	if rangeErr != nil {
+		return Guess{}, rangeErr
+	}
+	return Guess{}, err
+}
+
+// Formats a time of day in the layout it was given in.
+func formatTime(guess Guess) string {
+	t := time.Time{}.Add(time.Duration(guess.value) * time.Second)
+	for _, l := range timeLayouts {
+		if l.precision == guess.precision {
+			return t.Format(l.layout)
+		}
+	}
+	return t.Format("15:04")
+}
+
+// Reads a whole number.
+func parseNumber(s string) (Guess, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return Guess{}, err
+	}
+	if n > MAX_NUMBER || n < -MAX_NUMBER {
+		return Guess{}, &RangeError{"number"}
+	}
+	return Guess{value: n, precision: 1}, nil
+}
+
+// Reads a duration of minutes and seconds, with up to three decimals of
+// fractional seconds, such as 1:23.4. The precision is that of the last
+// decimal given.
+func parseDuration(s string) (Guess, error) {
+	minutes, seconds, found := strings.Cut(s, ":")
+	if !found {
+		return Guess{}, errors.New("missing minutes")
+	}
+	whole, fraction, _ := strings.Cut(seconds, ".")
+	if len(minutes) < 1 || len(whole) != 2 || len(fraction) > 3 || strings.HasSuffix(seconds, ".") {
+		return Guess{}, errors.New("invalid duration")
+	}
+	for _, part := range []string{minutes, whole, fraction} {
+		if strings.Trim(part, "0123456789") != "" {
+			return Guess{}, errors.New("invalid duration")
+		}
+	}
+
+	m, err := strconv.ParseInt(minutes, 10, 64)
+	if err != nil || m >= MAX_DURATION_MINUTES {
+		return Guess{}, &RangeError{"minute"}
+	}
+	sec, _ := strconv.ParseInt(whole, 10, 64)
+	if sec >= 60 {
+		return Guess{}, &RangeError{"second"}
+	}
+	precision := int64(1000)
+	var millis int64
+	for _, digit := range fraction {
+		precision /= 10
+		millis += int64(digit - '0') * precision
+	}
+	return Guess{value: (m * 60 + sec) * 1000 + millis, precision: precision}, nil
+}
+
+// Formats a duration with as many decimals as it was given with.
+func formatDuration(guess Guess) string {
+	seconds := guess.value / 1000
+	s := strconv.FormatInt(seconds / 60, 10) + ":" + fmt.Sprintf("%02d", seconds % 60)
+	if guess.precision < 1000 {
+		digits := 3
+		for p := guess.precision; p > 1; p /= 10 {
+			digits--
+		}
+		fraction := fmt.Sprintf("%03d", guess.value % 1000)
+		s += "." + fraction[:digits]
+	}
+	return s
+}
+
+// Returns the absolute difference between two guesses, compared in the
+// coarsest precision of either so a guess in minutes is not penalized
+// against a result in seconds.
+func distance(a Guess, b Guess) int64 {
+	precision := a.precision
+	if b.precision > precision {
+		precision = b.precision
+	}
+	d := a.value - a.value % precision - (b.value - b.value % precision)
+	if d < 0 { d = -d }
+	return d
+}
+
+// Formats a distance between two values of this kind.
+func (kind *Kind) formatDistance(d int64) string {
+	if kind.unit > 0 {
+		return (time.Duration(d) * kind.unit).String()
+	}
+	return strconv.FormatInt(d, 10)
+}
+
+// Formats given guesses as a comma separated list.
+func joinGuesses(guesses []Guess) string {
+	s := make([]string, len(guesses))
+	for i, guess := range guesses {
+		s[i] = guess.String()
+	}
+	return strings.Join(s, ", ")
+}
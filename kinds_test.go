@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTwelveHourTimes(t *testing.T) {
+	for twelve, twentyFour := range map[string]string{
+		"3:04pm": "15:04",
+		"3:04PM": "15:04",
+		"3:04am": "03:04",
+		"12:30am": "00:30",
+		"12:30pm": "12:30",
+		"3:04:05pm": "15:04:05",
+	} {
+		a, err := parseTime(twelve)
+		if err != nil {
+			t.Errorf("%s: %v", twelve, err)
+			continue
+		}
+		b, _ := parseTime(twentyFour)
+		if a.value != b.value || a.precision != b.precision {
+			t.Errorf("%s reads as %+v, want %+v as %s", twelve, a, b, twentyFour)
+		}
+	}
+}
+
+func TestTwelveHourBetMatchesTwentyFourHourResult(t *testing.T) {
+	round := testRound(t, MODE_EXACT, map[string]string{"twelve": "3:04pm", "morning": "3:04am"})
+	expectWinners(t, determineWinners(round, guesses(t, timeKind, "15:04"), 0), "twelve")
+
+	// And the other way around.
+	round = testRound(t, MODE_EXACT, map[string]string{"twentyfour": "15:04"})
+	expectWinners(t, determineWinners(round, guesses(t, timeKind, "3:04PM"), 0), "twentyfour")
+}
+
+func TestLenientTimes(t *testing.T) {
+	for given, want := range map[string]string{
+		// Without colons.
+		"1504": "15:04",
+		"0904": "09:04",
+		"150405": "15:04:05",
+		"0304pm": "15:04",
+		// Dotted.
+		"15.04": "15:04",
+		"9.04": "09:04",
+		"15.04.05": "15:04:05",
+		"3.04pm": "15:04",
+		// Zero-padded.
+		"09:04": "09:04",
+		"9:04": "09:04",
+		"00:05": "00:05",
+	} {
+		guess, err := timeKind.parse(given)
+		if err != nil {
+			t.Errorf("%s: %v", given, err)
+		} else if got := guess.String(); got != want {
+			t.Errorf("%s reads as %s, want %s", given, got, want)
+		}
+	}
+}
+
+func TestAmbiguousAndInvalidTimes(t *testing.T) {
+	var ambiguousErr *AmbiguousError
+	if _, err := parseTime("154"); !errors.As(err, &ambiguousErr) || len(ambiguousErr.readings) != 2 {
+		t.Errorf("154 yields %v, want two readings", err)
+	}
+	// 90:04 is no time, leaving 9:04 to suggest.
+	if _, err := parseTime("904"); !errors.As(err, &ambiguousErr) || len(ambiguousErr.readings) != 1 {
+		t.Errorf("904 yields %v, want a single reading", err)
+	}
+	// Neither 9:75 nor 97:05 are times.
+	if _, err := parseTime("975"); !errors.As(err, &ambiguousErr) || len(ambiguousErr.readings) != 0 {
+		t.Errorf("975 yields %v, want no readings", err)
+	}
+	var rangeErr *RangeError
+	for _, given := range []string{"2504", "25.04", "1575"} {
+		if _, err := parseTime(given); !errors.As(err, &rangeErr) {
+			t.Errorf("%s yields %v, want a range error", given, err)
+		}
+	}
+	for _, given := range []string{"15", "15043", "1504050", "15.04.05.06", "15:04.05"} {
+		if _, err := parseTime(given); err == nil {
+			t.Errorf("%s reads as a time", given)
+		}
+	}
+}
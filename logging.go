@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// The format of log output, either "text" or "json".
+const ENV_LOG_FORMAT = "FRAMMIEBOT_LOG_FORMAT"
+
+// The minimum level of log output: "debug", "info", "warn" or "error".
+const ENV_LOG_LEVEL = "FRAMMIEBOT_LOG_LEVEL"
+
+// Whether to log every incoming message at debug level, which must be
+// enabled through the log level as well. Off by default, as it logs what
+// users write.
+const ENV_DEBUG_MESSAGES = "FRAMMIEBOT_DEBUG_MESSAGES"
+
+// Whether incoming messages are logged, resolved on startup.
+var debugMessages = false
+
+// Configures the default structured logger from the environment.
+func setupLogging() error {
+	var level slog.Level
+	if l, exist := os.LookupEnv(ENV_LOG_LEVEL); exist {
+		if err := level.UnmarshalText([]byte(l)); err != nil {
+			return errors.New("invalid log level in environment variable " + ENV_LOG_LEVEL)
+		}
+	}
+
+	_, debugMessages = os.LookupEnv(ENV_DEBUG_MESSAGES)
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format, _ := os.LookupEnv(ENV_LOG_FORMAT); strings.ToLower(format) {
+		case "", "text":
+			handler = slog.NewTextHandler(os.Stderr, options)
+		case "json":
+			handler = slog.NewJSONHandler(os.Stderr, options)
+		default:
+			return errors.New("invalid log format in environment variable " + ENV_LOG_FORMAT)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Logs given message at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gempir/go-twitch-irc/v2"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The address to serve Prometheus metrics on. Metrics are not served when
+// unset.
+const ENV_METRICS_ADDR = "FRAMMIEBOT_METRICS_ADDR"
+
+// A Counter is a monotonically increasing metric, optionally partitioned by
+// the values of a single label.
+type Counter struct {
+	sync.Mutex
+	name string
+	help string
+	label string
+	values map[string]uint64
+}
+
+// Creates a counter partitioned by given label, or not partitioned if the
+// label is empty.
+func newCounter(name string, help string, label string) *Counter {
+	return &Counter{name: name, help: help, label: label, values: make(map[string]uint64)}
+}
+
+// Increments the counter for given label value. The value is ignored for
+// counters without a label.
+func (c *Counter) Inc(value string) {
+	if c.label == "" {
+		value = ""
+	}
+	c.Lock()
+	c.values[value]++
+	c.Unlock()
+}
+
+// Returns the total of the counter over all label values.
+func (c *Counter) Total() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	var total uint64
+	for _, n := range c.values {
+		total += n
+	}
+	return total
+}
+
+// Writes the counter in the Prometheus text exposition format.
+func (c *Counter) write(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if c.label == "" {
+		fmt.Fprintf(w, "%s %d\n", c.name, c.values[""])
+		return
+	}
+	values := make([]string, 0, len(c.values))
+	for value := range c.values {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, value, c.values[value])
+	}
+}
+
+var (
+	messagesTotal = newCounter("frammiebot_messages_total", "Chat messages processed.", "")
+	commandsTotal = newCounter("frammiebot_commands_total", "Commands handled by command.", "command")
+	roundsStartedTotal = newCounter("frammiebot_rounds_started_total", "Betting rounds started.", "")
+	roundsEndedTotal = newCounter("frammiebot_rounds_ended_total", "Betting rounds ended.", "")
+	betsTotal = newCounter("frammiebot_bets_total", "Bets placed.", "")
+	coffeeTotal = newCounter("frammiebot_coffee_total", "Times the coffee trigger fired.", "")
+	triggersTotal = newCounter("frammiebot_triggers_total", "Times the configured triggers fired by trigger.", "trigger")
+)
+
+// All exposed metrics.
+var metrics = []*Counter{messagesTotal, commandsTotal, roundsStartedTotal, roundsEndedTotal, betsTotal, coffeeTotal, triggersTotal}
+
+// Reports the operational statistics of the bot in chat.
+func botStats(message *twitch.PrivateMessage, args []string) {
+	rounds := allRounds()
+	bets := 0
+	for _, round := range rounds {
+		round.Lock()
+		bets += len(round.bets)
+		round.Unlock()
+	}
+	respond(message, fmt.Sprintf("%d message(s) processed, %d open round(s) with %d bet(s) across %d channel(s), up %s.",
+		messagesTotal.Total(), len(rounds), bets, len(joinedChannels()), formatUptime(time.Since(startedAt))))
+}
+
+// Serves all metrics in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, metric := range metrics {
+		metric.write(w)
+	}
+}
+
+// Serves metrics on given address in the background.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	go func() {
+		slog.Info("Serving metrics", "event", "metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Failed to serve metrics", "event", "metrics", "addr", addr, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// The minimum time between two raid greetings on the same channel.
+const RAID_COOLDOWN = 30 * time.Second
+
+// Handles notices of events on a channel, such as raids and subscriptions.
+func onUserNoticeMessage(message twitch.UserNoticeMessage) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	switch message.MsgID {
+		case "raid":
+			raider := message.MsgParams["msg-param-displayName"]
+			viewers := message.MsgParams["msg-param-viewerCount"]
+			slog.Info("Raided", "event", "raid", "channel", message.Channel, "raider", raider, "viewers", viewers)
+			if !checkCooldown(message.Channel, "raid", RAID_COOLDOWN) { return }
+			greeting := strings.NewReplacer("{raider}", raider, "{viewers}", viewers).Replace(accessibleText(config.RaidGreeting))
+			chat.Say(message.Channel, greeting)
+		case "sub", "resub", "subgift", "anonsubgift":
+			thankSubscriber(message)
+	}
+}
+
+// Handles notices about the bot itself, such as failing to talk in a channel
+// it is banned from.
+func onNoticeMessage(message twitch.NoticeMessage) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	switch message.MsgID {
+		case "msg_banned":
+			slog.Error("Banned from channel, unban the bot to use it here", "event", "banned", "channel", message.Channel, "reason", message.Message)
+			if config.LeaveWhenBanned {
+				leaveChannel(message.Channel)
+			}
+		case "msg_timedout":
+			slog.Warn("Timed out on channel, messages are dropped until it ends", "event", "timeout", "channel", message.Channel, "reason", message.Message)
+		case "msg_channel_suspended", "msg_channel_blocked":
+			// Leaving stops the client from joining the channel again on
+			// every reconnect.
+			slog.Error("Channel does not exist or is suspended, leaving it", "event", "channel_unavailable", "channel", message.Channel, "reason", message.Message)
+			leaveChannel(message.Channel)
+		default:
+			if strings.HasPrefix(message.MsgID, "msg_") {
+				slog.Warn("Message rejected by Twitch", "event", "notice", "channel", message.Channel, "notice", message.MsgID, "reason", message.Message)
+			}
+	}
+}
+
+// Handles chat being cleared, which is how Twitch tells the bot it has been
+// banned or timed out.
+func onClearChatMessage(message twitch.ClearChatMessage) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if message.TargetUsername != username { return }
+	if message.BanDuration == 0 {
+		slog.Error("Banned from channel, unban the bot to use it here", "event", "banned", "channel", message.Channel, "reason", message.Tags["ban-reason"])
+		if config.LeaveWhenBanned {
+			leaveChannel(message.Channel)
+		}
+		return
+	}
+	duration := time.Duration(message.BanDuration) * time.Second
+	slog.Warn("Timed out on channel, messages are dropped until it ends", "event", "timeout", "channel", message.Channel, "duration", duration, "reason", message.Tags["ban-reason"])
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"github.com/gempir/go-twitch-irc/v2"
+	"strings"
+)
+
+// A Level is the permission level of a user on a channel. Each level
+// includes all levels below it.
+type Level int
+
+const (
+	LEVEL_EVERYONE Level = iota
+	LEVEL_SUBSCRIBER
+	LEVEL_VIP
+	LEVEL_MOD
+	LEVEL_BROADCASTER
+)
+
+// The names of the levels, as used in the configuration file.
+var levelNames = map[string]Level{
+	"everyone": LEVEL_EVERYONE,
+	"subscriber": LEVEL_SUBSCRIBER,
+	"vip": LEVEL_VIP,
+	"mod": LEVEL_MOD,
+	"broadcaster": LEVEL_BROADCASTER,
+}
+
+// How the levels are referred to in responses.
+var levelDescriptions = map[Level]string{
+	LEVEL_EVERYONE: "anyone",
+	LEVEL_SUBSCRIBER: "a subscriber",
+	LEVEL_VIP: "a VIP",
+	LEVEL_MOD: "a moderator",
+	LEVEL_BROADCASTER: "the broadcaster",
+}
+
+// Reads a level from its name.
+func parseLevel(name string) (Level, error) {
+	level, exist := levelNames[name]
+	if !exist {
+		return 0, errors.New("unknown permission level " + name)
+	}
+	return level, nil
+}
+
+// Returns the highest level given user has according to their badges. The
+// owner of the bot has every level, and Twitch staff, admins and global
+// moderators are moderators everywhere.
+func userLevel(user *twitch.User) Level {
+	switch {
+		case user.Name == owner || hasBadge(user, "broadcaster"):
+			return LEVEL_BROADCASTER
+		case hasBadge(user, "moderator", "staff", "admin", "global_mod"):
+			return LEVEL_MOD
+		case hasBadge(user, "vip"):
+			return LEVEL_VIP
+		case hasBadge(user, "subscriber", "founder"):
+			return LEVEL_SUBSCRIBER
+	}
+	return LEVEL_EVERYONE
+}
+
+// Whether given user has any of given badges. Only their presence counts, as
+// versions need not be positive numbers; new subscribers have subscriber/0.
+func hasBadge(user *twitch.User, badges ...string) bool {
+	for _, badge := range badges {
+		if _, exist := user.Badges[badge]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the level required to run given command, named by given path such
+// as "bet start". The configured level takes precedence over the default
+// level of the command.
+func requiredLevel(command *Command, path string) Level {
+	if name, exist := config.Permissions[path]; exist {
+		if level, err := parseLevel(name); err == nil {
+			return level
+		}
+	}
+	return command.permission
+}
+
+// Checks that every configured permission names an existing command and a
+// known level.
+func validatePermissions(permissions map[string]string) error {
+	for path, name := range permissions {
+		if _, err := parseLevel(name); err != nil {
+			return errors.New("invalid permissions for " + path + ": " + err.Error())
+		}
+		list := commands
+		var command *Command
+		for _, part := range strings.Fields(path) {
+			if command = findCommand(list, part); command == nil {
+				return errors.New("invalid permissions: unknown command " + path)
+			}
+			list = command.subcommands
+		}
+		if command == nil {
+			return errors.New("invalid permissions: unknown command " + path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"testing"
+)
+
+func TestUserLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		badges map[string]int
+		want Level
+	}{
+		{"staff only", map[string]int{"staff": 1}, LEVEL_MOD},
+		{"admin only", map[string]int{"admin": 1}, LEVEL_MOD},
+		{"global moderator only", map[string]int{"global_mod": 1}, LEVEL_MOD},
+		{"broadcaster only", map[string]int{"broadcaster": 1}, LEVEL_BROADCASTER},
+		{"broadcaster and moderator", map[string]int{"broadcaster": 1, "moderator": 1}, LEVEL_BROADCASTER},
+		{"vip and subscriber", map[string]int{"vip": 1, "subscriber": 12}, LEVEL_VIP},
+		// New subscribers have version 0 of the badge.
+		{"new subscriber", map[string]int{"subscriber": 0}, LEVEL_SUBSCRIBER},
+		{"founder", map[string]int{"founder": 0}, LEVEL_SUBSCRIBER},
+		{"other badges", map[string]int{"premium": 1}, LEVEL_EVERYONE},
+		{"empty badges", map[string]int{}, LEVEL_EVERYONE},
+		{"nil badges", nil, LEVEL_EVERYONE},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := &twitch.User{Name: "viewer", Badges: test.badges}
+			if level := userLevel(user); level != test.want {
+				t.Errorf("level is %s, want %s", levelDescriptions[level], levelDescriptions[test.want])
+			}
+		})
+	}
+}
+
+// The owner of the bot has every level, badges or not.
+func TestOwnerLevel(t *testing.T) {
+	if level := userLevel(&twitch.User{Name: owner}); level != LEVEL_BROADCASTER {
+		t.Errorf("owner is %s, want %s", levelDescriptions[level], levelDescriptions[LEVEL_BROADCASTER])
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prefix of the bet argument wagering points on the bet.
+const WAGER_PREFIX = "wager="
+
+// The largest number of points given or taken at once, keeping balances far
+// from overflowing.
+const MAX_POINTS_GRANT = 1000000000
+
+// The points balance per user per channel. Users are keyed by lowercase name
+// like their statistics.
+var points = struct {
+	sync.Mutex
+	balances map[string]map[string]int64
+}{balances: make(map[string]map[string]int64)}
+
+// Returns the points balance of given user on given channel.
+func balanceOf(channel string, user string) int64 {
+	points.Lock()
+	defer points.Unlock()
+	return points.balances[channel][strings.ToLower(user)]
+}
+
+// Adds given amount of points to the balance of given user on given channel,
+// which may be negative to take points. The balance never drops below zero.
+// Returns the new balance. Points must be locked by the caller.
+func addPoints(channel string, user string, amount int64) int64 {
+	users, exist := points.balances[channel]
+	if !exist {
+		users = make(map[string]int64)
+		points.balances[channel] = users
+	}
+	user = strings.ToLower(user)
+	balance := users[user] + amount
+	if balance < 0 {
+		balance = 0
+	}
+	users[user] = balance
+	return balance
+}
+
+// Replaces the wager of given user on given channel by a new wager, returning
+// the previous wager to their balance first. Returns false, leaving the
+// balance untouched, if the user can not afford the new wager.
+func changeWager(channel string, user string, previous int64, wager int64) bool {
+	points.Lock()
+	defer points.Unlock()
+	if points.balances[channel][strings.ToLower(user)] + previous < wager {
+		return false
+	}
+	addPoints(channel, user, previous - wager)
+	return true
+}
+
+// Returns the wagers of given bets to the users who placed them.
+func refundWagers(channel string, bets map[string]*Bet) {
+	points.Lock()
+	defer points.Unlock()
+	for user, bet := range bets {
+		if bet.wager > 0 {
+			addPoints(channel, user, bet.wager)
+		}
+	}
+}
+
+// Pays the wagers of all bets of given round out to its winners, split
+// evenly. Points that do not divide evenly go to the winners first in
+// alphabetical order. Wagers are refunded when nobody won. Returns the total
+// wagered. Round must be locked by the caller.
+func payOut(round *BettingRound, winners []string) int64 {
+	var pot int64
+	for _, bet := range round.bets {
+		pot += bet.wager
+	}
+	if pot == 0 { return 0 }
+	if len(winners) == 0 {
+		refundWagers(round.channel, round.bets)
+		return pot
+	}
+
+	sorted := append([]string(nil), winners...)
+	sort.Strings(sorted)
+	share, rest := pot / int64(len(sorted)), pot % int64(len(sorted))
+	points.Lock()
+	defer points.Unlock()
+	for i, winner := range sorted {
+		payout := share
+		if int64(i) < rest {
+			payout++
+		}
+		addPoints(round.channel, winner, payout)
+	}
+	return pot
+}
+
+// Shows the total of the points wagered on a round, along with what the
+// winners would get.
+func betPot(message *twitch.PrivateMessage, args []string) {
+	round, _ := checkActiveBidding(message, args)
+	if round == nil { return }
+
+	round.Lock()
+	var pot int64
+	wagers := 0
+	for _, bet := range round.bets {
+		if bet.wager > 0 {
+			pot += bet.wager
+			wagers++
+		}
+	}
+	round.Unlock()
+	if pot == 0 {
+		respond(message, "No points have been wagered" + onRound(round.name) + ", add " + WAGER_PREFIX + "N to your bet to wager some.")
+		return
+	}
+	respond(message, "The pot" + onRound(round.name) + " is " + strconv.FormatInt(pot, 10) + " point(s) from " + strconv.Itoa(wagers) + " wager(s). A single winner takes it all, two winners get about " + strconv.FormatInt(pot / 2, 10) + " each.")
+}
+
+// Splits the wager off the arguments of a bet on a round of given kind. The
+// wager is given as the last argument, either prefixed by wager= or as a
+// whole number that is not a value of the kind. On rounds of times, a whole
+// number is always the wager, though it may read as a time without colons.
+// Returns false if the wager is invalid.
+func splitWager(kind *Kind, args []string) ([]string, int64, bool) {
+	if len(args) < 2 { return args, 0, true }
+	last := args[len(args)-1]
+	if strings.HasPrefix(last, WAGER_PREFIX) {
+		wager, err := strconv.ParseInt(strings.TrimPrefix(last, WAGER_PREFIX), 10, 64)
+		if err != nil || wager < 1 {
+			return args, 0, false
+		}
+		return args[:len(args)-1], wager, true
+	}
+	bare := strings.Trim(last, "0123456789") == ""
+	if _, err := kind.parse(last); err == nil && !(kind == timeKind && bare) {
+		return args, 0, true
+	}
+	if wager, err := strconv.ParseInt(last, 10, 64); err == nil && wager > 0 {
+		return args[:len(args)-1], wager, true
+	}
+	return args, 0, true
+}
+
+// Shows the points balance of the given user, or of the requesting user if
+// none is given.
+func pointsCommand(message *twitch.PrivateMessage, args []string) {
+	user := message.User.DisplayName
+	if len(args) > 0 {
+		user = strings.TrimPrefix(args[0], "@")
+	}
+	balance := balanceOf(message.Channel, user)
+	if len(args) > 0 {
+		respond(message, user + " has " + strconv.FormatInt(balance, 10) + " point(s).")
+		return
+	}
+	respond(message, "You have " + strconv.FormatInt(balance, 10) + " point(s).")
+}
+
+// Gives points to a user, or takes them when the amount is negative.
+func givePoints(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 2 {
+		respond(message, "Format: givepoints <user> <amount>")
+		return
+	}
+	user := strings.TrimPrefix(args[0], "@")
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || amount == 0 || amount > MAX_POINTS_GRANT || amount < -MAX_POINTS_GRANT {
+		respond(message, "The amount must be a whole number other than 0, at most " + strconv.Itoa(MAX_POINTS_GRANT) + ".")
+		return
+	}
+	points.Lock()
+	balance := addPoints(message.Channel, user, amount)
+	points.Unlock()
+	saveState()
+	audit(AuditEntry{Event: "points", Channel: message.Channel, User: message.User.DisplayName, Target: user, Amount: amount})
+	respond(message, user + " now has " + strconv.FormatInt(balance, 10) + " point(s).")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitWager(t *testing.T) {
+	tests := []struct {
+		kind *Kind
+		args []string
+		rest []string
+		wager int64
+	}{
+		{timeKind, []string{"15:04", "1000"}, []string{"15:04"}, 1000},
+		{timeKind, []string{"15:04", "500"}, []string{"15:04"}, 500},
+		{timeKind, []string{"15:04", "wager=1504"}, []string{"15:04"}, 1504},
+		// A trailing whole number is the wager, even if it reads as a time.
+		{timeKind, []string{"1504", "1600"}, []string{"1504"}, 1600},
+		{timeKind, []string{"15:04", "16.00"}, []string{"15:04", "16.00"}, 0},
+		{timeKind, []string{"1504"}, []string{"1504"}, 0},
+		{numberKind, []string{"5", "10"}, []string{"5", "10"}, 0},
+		{numberKind, []string{"5", "wager=10"}, []string{"5"}, 10},
+		{durationKind, []string{"1:23.4", "100"}, []string{"1:23.4"}, 100},
+	}
+	for _, test := range tests {
+		rest, wager, ok := splitWager(test.kind, test.args)
+		if !ok || wager != test.wager || !reflect.DeepEqual(rest, test.rest) {
+			t.Errorf("%s %q splits into %q wagering %d (%v), want %q wagering %d", test.kind.name, test.args, rest, wager, ok, test.rest, test.wager)
+		}
+	}
+	if _, _, ok := splitWager(timeKind, []string{"15:04", "wager=0"}); ok {
+		t.Error("a wager of 0 is accepted")
+	}
+}
+
+func TestWagerOnTime(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	points.Lock()
+	addPoints(channel, "viewer", 1500)
+	points.Unlock()
+
+	send(channel, "mod", "!bet start", "moderator")
+	fake.takeSaid()
+	send(channel, "viewer", "!bet 15:04 1000")
+	send(channel, "viewer", "!bet mybet")
+	expectTexts(t, fake.takeSaid(), "viewer -> Wagered 1000 point(s), good luck!", "viewer -> Your bet: 15:04, wagering 1000 point(s)")
+	if balance := balanceOf(channel, "viewer"); balance != 500 {
+		t.Errorf("balance is %d, want 500", balance)
+	}
+}
+
+// A bet handled after its round ended must not take the wager, as nothing
+// would ever pay it out or refund it.
+func TestBetOnEndedRoundKeepsWager(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	points.Lock()
+	addPoints(channel, "viewer", 1500)
+	points.Unlock()
+
+	send(channel, "mod", "!bet start grace=1m", "moderator")
+	round := getRound(channel, "")
+	send(channel, "mod", "!bet close", "moderator")
+	send(channel, "mod", "!bet end 15:04", "moderator")
+	fake.takeSaid()
+
+	// Sent within the grace period, but handled once the round ended.
+	_, err := round.place("viewer", guesses(t, timeKind, "15:04"), time.Now(), 1000)
+	if !errors.Is(err, ErrRoundClosed) {
+		t.Errorf("placing on an ended round returned %v, want %v", err, ErrRoundClosed)
+	}
+	if balance := balanceOf(channel, "viewer"); balance != 1500 {
+		t.Errorf("balance is %d, want 1500", balance)
+	}
+	round.Lock()
+	defer round.Unlock()
+	if _, exist := round.bets["viewer"]; exist {
+		t.Error("the bet was recorded on the ended round")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The longest prefix a channel may set.
+const MAX_PREFIX_LENGTH = 5
+
+// The command prefixes of channels using their own, along with the compiled
+// regular expressions matching their commands.
+var prefixes = struct {
+	sync.Mutex
+	channels map[string]string
+	regexes map[string]*regexp.Regexp
+}{channels: make(map[string]string), regexes: make(map[string]*regexp.Regexp)}
+
+// Returns the command prefix of given channel, which is the configured prefix
+// unless the channel set its own.
+func prefixOf(channel string) string {
+	prefixes.Lock()
+	defer prefixes.Unlock()
+	if prefix, exist := prefixes.channels[channel]; exist {
+		return prefix
+	}
+	return config.Prefix
+}
+
+// Returns the regular expression matching commands on given channel.
+func commandRegexOf(channel string) *regexp.Regexp {
+	prefixes.Lock()
+	defer prefixes.Unlock()
+	if regex, exist := prefixes.regexes[channel]; exist {
+		return regex
+	}
+	return regex["command"]
+}
+
+// Returns the text of the command in given message, following the command
+// prefix of its channel or, if enabled, a mention of the bot at its start.
+// Returns false if the message is no command.
+func commandText(message *twitch.PrivateMessage) (string, bool) {
+	if split := commandRegexOf(message.Channel).FindStringSubmatch(message.Message); len(split) > 1 {
+		return split[1], true
+	}
+	if !config.MentionCommands { return "", false }
+	mention := "@" + username
+	if len(message.Message) <= len(mention) || !strings.EqualFold(message.Message[:len(mention)], mention) {
+		return "", false
+	}
+	// Only the full name counts, possibly followed by punctuation as in
+	// "@frammiebot, help".
+	rest := message.Message[len(mention):]
+	if !strings.ContainsAny(rest[:1], " ,:") { return "", false }
+	return strings.TrimLeft(rest, " ,:"), true
+}
+
+// Sets the command prefix of given channel. The empty prefix makes the
+// channel use the configured prefix again. Prefixes must be locked by the
+// caller.
+func setPrefix(channel string, prefix string) {
+	if prefix == "" {
+		delete(prefixes.channels, channel)
+		delete(prefixes.regexes, channel)
+		return
+	}
+	prefixes.channels[channel] = prefix
+	prefixes.regexes[channel] = commandRegex(prefix)
+}
+
+// Sets the command prefix of the channel, or resets it to the configured
+// prefix.
+func prefixCommand(message *twitch.PrivateMessage, args []string) {
+	// The tokenizer drops most punctuation, so read the prefix as written.
+	prefix := rawArgs(message, 1)
+	if prefix == "" {
+		respond(message, "The prefix is " + prefixOf(message.Channel) + ". Format: " + prefixOf(message.Channel) + "prefix <prefix|reset>")
+		return
+	}
+	if prefix == "reset" {
+		prefixes.Lock()
+		setPrefix(message.Channel, "")
+		prefixes.Unlock()
+		saveState()
+		respond(message, "The prefix is back to " + config.Prefix + ".")
+		return
+	}
+	// Twitch reserves messages starting with a slash or dot for its own
+	// commands.
+	if utf8.RuneCountInString(prefix) > MAX_PREFIX_LENGTH || strings.IndexFunc(prefix, unicode.IsSpace) >= 0 || strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, ".") {
+		respond(message, "The prefix must be at most " + strconv.Itoa(MAX_PREFIX_LENGTH) + " characters without spaces, and may not start with / or .")
+		return
+	}
+	prefixes.Lock()
+	setPrefix(message.Channel, prefix)
+	prefixes.Unlock()
+	saveState()
+	respond(message, "Commands now start with " + prefix + ", such as " + prefix + "help.")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The window Twitch applies its message rate limit over.
+const RATE_WINDOW = 30 * time.Second
+
+// The number of messages that may be sent per rate window when none is
+// configured, the limit Twitch applies to accounts that are not moderator.
+const DEFAULT_MESSAGE_RATE = 20
+
+// The number of messages waiting to be sent beyond which further messages
+// are dropped.
+const MAX_QUEUED_MESSAGES = 50
+
+// Appended to a message identical to the previous message on the same
+// channel, as Twitch drops such duplicates. The character is invisible in
+// chat.
+const DUPLICATE_SUFFIX = " \U000E0000"
+
+// A queued chat message, or a change of the channels joined.
+type queuedMessage struct {
+	channel string
+	text string
+	// The channels to join instead of saying the text, if any.
+	join []string
+	// Whether to depart the channel instead of saying the text.
+	depart bool
+}
+
+// A RateLimitedChat is a ChatClient that limits the rate at which messages
+// are said through the wrapped client using a token bucket. Messages
+// exceeding the rate are queued and sent once the rate allows, or dropped
+// if too many are waiting already. Messages repeating the previous message
+// on their channel are made unique if configured. Messages are held back as
+// slow mode requires, and dropped where the bot can not chat. Whispers and
+// joins are passed through as is. Departures are queued along with the
+// messages but not limited, so a channel is left only after the messages
+// said there before, and so are joins of channels waiting to be departed.
+type RateLimitedChat struct {
+	ChatClient
+	queue chan queuedMessage
+
+	mutex sync.Mutex
+	// The number of messages that may be sent right away.
+	tokens float64
+	// The number of messages allowed per rate window.
+	rate int
+	// When the tokens were last refilled.
+	refilled time.Time
+	// The number of departures queued per channel. Guarded by the mutex.
+	departing map[string]int
+	// The message last sent per channel. Only used by the sender.
+	last map[string]string
+	// When a message was last sent per channel. Only used by the sender.
+	sent map[string]time.Time
+}
+
+// Returns given client limited to given number of messages per rate window.
+// Starts sending queued messages in the background.
+func newRateLimitedChat(c ChatClient, rate int) *RateLimitedChat {
+	limited := &RateLimitedChat{
+		ChatClient: c,
+		queue: make(chan queuedMessage, MAX_QUEUED_MESSAGES),
+		tokens: float64(rate),
+		rate: rate,
+		refilled: time.Now(),
+		departing: make(map[string]int),
+		last: make(map[string]string),
+		sent: make(map[string]time.Time),
+	}
+	go limited.send()
+	return limited
+}
+
+// Queues given message to be said once the rate allows.
+func (c *RateLimitedChat) Say(channel string, text string) {
+	select {
+	case c.queue <- queuedMessage{channel: channel, text: text}:
+	default:
+		slog.Warn("Dropped outgoing message, too many are waiting", "event", "throttle", "channel", channel)
+	}
+}
+
+// Joins given channels, after the departures of any of them still queued.
+func (c *RateLimitedChat) Join(channels ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	queued := false
+	for _, channel := range channels {
+		queued = queued || c.departing[channel] > 0
+	}
+	if !queued {
+		c.ChatClient.Join(channels...)
+		return
+	}
+	select {
+	case c.queue <- queuedMessage{join: channels}:
+	default:
+		c.ChatClient.Join(channels...)
+	}
+}
+
+// Departs given channel once the messages queued before have been said, so
+// a goodbye is not dropped. Departs right away if too many are waiting.
+func (c *RateLimitedChat) Depart(channel string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	select {
+	case c.queue <- queuedMessage{channel: channel, depart: true}:
+		c.departing[channel]++
+	default:
+		c.ChatClient.Depart(channel)
+	}
+}
+
+// Adds the tokens earned since the last refill, up to the rate. The caller
+// must hold the mutex.
+func (c *RateLimitedChat) refill() {
+	now := time.Now()
+	c.tokens += now.Sub(c.refilled).Seconds() * float64(c.rate) / RATE_WINDOW.Seconds()
+	if c.tokens > float64(c.rate) {
+		c.tokens = float64(c.rate)
+	}
+	c.refilled = now
+}
+
+// Takes a token, returning how long to wait first if none is available.
+func (c *RateLimitedChat) take() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.refill()
+	c.tokens--
+	if c.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-c.tokens * float64(RATE_WINDOW) / float64(c.rate))
+}
+
+// Says queued messages through the wrapped client as the rate allows.
+func (c *RateLimitedChat) send() {
+	for message := range c.queue {
+		if message.join != nil {
+			c.ChatClient.Join(message.join...)
+			continue
+		}
+		if message.depart {
+			c.mutex.Lock()
+			c.ChatClient.Depart(message.channel)
+			if c.departing[message.channel]--; c.departing[message.channel] == 0 {
+				delete(c.departing, message.channel)
+			}
+			c.mutex.Unlock()
+			continue
+		}
+		if wait := c.take(); wait > 0 {
+			slog.Info("Throttling outgoing message", "event", "throttle", "channel", message.channel, "wait", wait, "queued", len(c.queue))
+			time.Sleep(wait)
+		}
+		if reason := chatBlocked(message.channel); reason != "" {
+			slog.Warn("Suppressed outgoing message", "event", "roomstate", "channel", message.channel, "reason", reason)
+			continue
+		}
+		if wait := time.Until(c.sent[message.channel].Add(slowInterval(message.channel))); wait > 0 {
+			if wait > MAX_SLOW_WAIT {
+				slog.Warn("Suppressed outgoing message", "event", "roomstate", "channel", message.channel, "reason", "slow", "wait", wait)
+				continue
+			}
+			slog.Info("Holding outgoing message for slow mode", "event", "roomstate", "channel", message.channel, "wait", wait)
+			time.Sleep(wait)
+		}
+		text := message.text
+		configLock.RLock()
+		dedupe := config.DedupeMessages
+		configLock.RUnlock()
+		if dedupe && text == c.last[message.channel] {
+			text += DUPLICATE_SUFFIX
+		}
+		c.last[message.channel] = text
+		c.sent[message.channel] = time.Now()
+		c.ChatClient.Say(message.channel, text)
+	}
+}
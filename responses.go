@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A Response is a text the bot responds with, decorated with emoji unless
+// in accessible mode, where the plain equivalent reads better with screen
+// readers. Placeholders in braces are replaced when formatting.
+type Response struct {
+	emoji string
+	plain string
+}
+
+// The responses decorated with emoji.
+var (
+	TIME_UP_RESPONSE = Response{"⏰ Time is up, betting{round} has closed! {locked} Everyone, good luck!", "Time is up, betting{round} has closed! {locked} Everyone, good luck!"}
+	REMINDER_RESPONSE = Response{"⏳ Betting{round} is still open! Place your bet with {usage}", "Betting{round} is still open! Place your bet with {usage}"}
+	EXPIRED_RESPONSE = Response{"⌛ Betting{round} was never ended and has expired, all bets are cancelled.", "Betting{round} was never ended and has expired, all bets are cancelled."}
+	NO_WINNERS_RESPONSE = Response{"✨ Unfortunately no winners this time, good luck on the next betting round!", "Unfortunately no winners this time, good luck on the next betting round!"}
+	WINNERS_RESPONSE = Response{"🎉 Congratulations to following winner(s): {winners}", "Congratulations to following winner(s): {winners}"}
+	WINNER_RESPONSE = Response{"🥳 - {winner}", "{winner}"}
+	// Separates the winners listed in WINNER_RESPONSE.
+	WINNER_SEPARATOR = Response{" ", ", "}
+	POT_RESPONSE = Response{" 💰 {points} point(s) are shared among the winner(s).", ". {points} point(s) are shared among the winner(s)."}
+	LEADERBOARD_RESPONSE = Response{"🏆 Leaderboard:", "Leaderboard:"}
+	COFFEE_ON_RESPONSE = Response{"Coffee is back on the menu! ☕", "Coffee is back on the menu!"}
+	ROLL_RESPONSE = Response{"🎲 You rolled {roll} (1-{sides}).", "You rolled {roll} (1-{sides})."}
+)
+
+// Formats the response in the style in effect, replacing the placeholders
+// given in pairs with their values.
+func (r Response) format(replacements ...string) string {
+	text := r.emoji
+	if config.Accessible {
+		text = r.plain
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// Formats the configured text if set, without its emoji in accessible mode,
+// or the response otherwise.
+func (r Response) formatConfigured(text string, replacements ...string) string {
+	if text == "" {
+		return r.format(replacements...)
+	}
+	return strings.NewReplacer(replacements...).Replace(accessibleText(text))
+}
+
+// Returns given configured text, such as a greeting, without its emoji in
+// accessible mode.
+func accessibleText(text string) string {
+	if !config.Accessible { return text }
+	return strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		// Emoji are symbols, possibly joined and modified by format
+		// characters and variation selectors.
+		if unicode.Is(unicode.So, r) || (unicode.Is(unicode.Sk, r) && r > unicode.MaxLatin1) || unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Variation_Selector, r) {
+			return -1
+		}
+		return r
+	}, text)), " ")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode"
+)
+
+// Every response, for checking the accessible variants.
+var allResponses = map[string]Response{
+	"time up": TIME_UP_RESPONSE,
+	"reminder": REMINDER_RESPONSE,
+	"expired": EXPIRED_RESPONSE,
+	"no winners": NO_WINNERS_RESPONSE,
+	"winners": WINNERS_RESPONSE,
+	"winner": WINNER_RESPONSE,
+	"winner separator": WINNER_SEPARATOR,
+	"pot": POT_RESPONSE,
+	"leaderboard": LEADERBOARD_RESPONSE,
+	"coffee on": COFFEE_ON_RESPONSE,
+	"roll": ROLL_RESPONSE,
+}
+
+// Whether given text contains any emoji.
+func hasEmoji(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.So, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Turns on accessible mode for the duration of given test.
+func useAccessible(t *testing.T) {
+	configLock.Lock()
+	previous := config
+	accessible := *config
+	accessible.Accessible = true
+	applyConfig(&accessible)
+	configLock.Unlock()
+	t.Cleanup(func() {
+		configLock.Lock()
+		applyConfig(previous)
+		configLock.Unlock()
+	})
+}
+
+// Returns the texts said through given fake, waiting until there is at
+// least one.
+func waitSaid(t *testing.T, fake *fakeChat) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if said := fake.takeSaid(); len(said) > 0 {
+			return said
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("nothing was said")
+	return nil
+}
+
+func TestAccessibleResponses(t *testing.T) {
+	useAccessible(t)
+	for name, response := range allResponses {
+		if text := response.format(); text != response.plain || hasEmoji(text) {
+			t.Errorf("%s response is %q in accessible mode, want %q without emoji", name, text, response.plain)
+		}
+	}
+	if text := COFFEE_ON_RESPONSE.formatConfigured("☕ Coffee for {user}! 🎉", "{user}", "viewer"); text != "Coffee for viewer!" {
+		t.Errorf("configured response is %q in accessible mode", text)
+	}
+}
+
+// The announcements of timers are formatted outside of message handlers, so
+// they must not race with reloading the configuration. Run with -race.
+func TestAccessibleAnnouncements(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	useAccessible(t)
+
+	// Keep reloading the configuration while the timers fire.
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"accessible": true, "max_round_age": "1ns", "announce_expiry": true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stop, reloaded := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for {
+			select {
+				case <-stop:
+					return
+				default:
+					reloadConfig(path)
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-reloaded
+	}()
+
+	send(channel, "mod", "!bet start 10ms", "moderator")
+	fake.takeSaid()
+	expectTexts(t, waitSaid(t, fake), "Time is up, betting has closed! 0 bet(s) locked in. Everyone, good luck!")
+
+	stopReminder, reminded := make(chan struct{}), make(chan struct{})
+	go func() {
+		remind(channel, "", 10 * time.Millisecond, stopReminder)
+		close(reminded)
+	}()
+	said := waitSaid(t, fake)
+	close(stopReminder)
+	<-reminded
+	fake.takeSaid()
+	if said[0] != "Betting is still open! Place your bet with !bet <value...>" {
+		t.Errorf("reminded %q", said[0])
+	}
+
+	expireOldRounds()
+	expectTexts(t, fake.takeSaid(), "Betting was never ended and has expired, all bets are cancelled.")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The directory exported round results are written to.
+const ENV_EXPORT_DIR = "FRAMMIEBOT_EXPORT_DIR"
+
+// How long the winners of the last round can be repeated when not
+// configured.
+const DEFAULT_WINNERS_EXPIRY = time.Hour
+
+// The number of ended rounds remembered per channel, which is also the most
+// that can be shown at once.
+const HISTORY_SIZE = 5
+
+// The number of ended rounds shown when none is given.
+const DEFAULT_HISTORY_COUNT = 3
+
+// A RoundResult is the outcome of an ended betting round.
+type RoundResult struct {
+	Channel string `json:"channel"`
+	// The name of the round, empty for the unnamed round.
+	Round string `json:"round,omitempty"`
+	Ended time.Time `json:"ended"`
+	Results []string `json:"results"`
+	Bets []ResultBet `json:"bets"`
+	Winners []string `json:"winners"`
+}
+
+// A ResultBet is the bet of a single user in an ended betting round.
+type ResultBet struct {
+	User string `json:"user"`
+	Times []string `json:"times"`
+	Placed time.Time `json:"placed"`
+	// Whether the bet was placed during the grace period after closing.
+	Late bool `json:"late,omitempty"`
+	Won bool `json:"won"`
+}
+
+// A HistoryEntry is the outcome of an ended betting round as remembered in
+// the history of its channel, without the bets.
+type HistoryEntry struct {
+	Round string `json:"round,omitempty"`
+	Ended time.Time `json:"ended"`
+	Results []string `json:"results"`
+	Winners []string `json:"winners"`
+}
+
+// The result of the most recently ended round per channel, along with the
+// history of the last rounds ended per channel, oldest first.
+var lastResults = struct {
+	sync.Mutex
+	results map[string]*RoundResult
+	history map[string][]HistoryEntry
+}{results: make(map[string]*RoundResult), history: make(map[string][]HistoryEntry)}
+
+// Directory exports are written to, resolved on startup.
+var exportDir = "."
+
+// Captures the outcome of given round for given results and winners, and
+// remembers it as the last result of the channel. Round must be locked by
+// the caller.
+func recordResult(channel string, round *BettingRound, results []Guess, winners []string) *RoundResult {
+	won := make(map[string]bool, len(winners))
+	for _, winner := range winners {
+		won[winner] = true
+	}
+
+	result := &RoundResult{Channel: channel, Round: round.name, Ended: time.Now(), Winners: winners}
+	for _, r := range results {
+		result.Results = append(result.Results, r.String())
+	}
+	for user, bet := range round.bets {
+		rb := ResultBet{User: user, Placed: bet.placed, Late: bet.late, Won: won[user]}
+		for _, t := range bet.times {
+			rb.Times = append(rb.Times, t.String())
+		}
+		result.Bets = append(result.Bets, rb)
+	}
+	sort.Slice(result.Bets, func(i, j int) bool {
+		return result.Bets[i].User < result.Bets[j].User
+	})
+
+	lastResults.Lock()
+	lastResults.results[channel] = result
+	history := append(lastResults.history[channel], HistoryEntry{Round: result.Round, Ended: result.Ended, Results: result.Results, Winners: result.Winners})
+	if len(history) > HISTORY_SIZE {
+		history = history[len(history) - HISTORY_SIZE:]
+	}
+	lastResults.history[channel] = history
+	lastResults.Unlock()
+	return result
+}
+
+// Returns the users that had a bet in the round.
+func (result *RoundResult) participants() []string {
+	users := make([]string, len(result.Bets))
+	for i, bet := range result.Bets {
+		users[i] = bet.User
+	}
+	return users
+}
+
+// Returns the result of the most recently ended round on given channel, or
+// nil if there is none.
+func lastResult(channel string) *RoundResult {
+	lastResults.Lock()
+	defer lastResults.Unlock()
+	return lastResults.results[channel]
+}
+
+// Repeats the results and winners of the most recently ended round on the
+// channel, unless it ended too long ago.
+func betWinners(message *twitch.PrivateMessage, args []string) {
+	result := lastResult(message.Channel)
+	if result == nil || time.Since(result.Ended) > config.WinnersExpiry.Duration {
+		respond(message, "There is no recently ended betting round.")
+		return
+	}
+	chat.Say(message.Channel, "The last round" + onRound(result.Round) + " ended with " + strings.Join(result.Results, ", ") + ". " + winnersAnnouncement(result.Winners, nil))
+}
+
+// Shows the outcomes of the last rounds ended on the channel, most recent
+// first.
+func betHistory(message *twitch.PrivateMessage, args []string) {
+	n := DEFAULT_HISTORY_COUNT
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 || n > HISTORY_SIZE {
+			respond(message, "Up to " + strconv.Itoa(HISTORY_SIZE) + " past rounds can be shown.")
+			return
+		}
+	}
+	lastResults.Lock()
+	history := lastResults.history[message.Channel]
+	if len(history) > n {
+		history = history[len(history) - n:]
+	}
+	entries := make([]string, len(history))
+	for i, entry := range history {
+		winners := "no winners"
+		if len(entry.Winners) > 0 {
+			winners = "won by " + strings.Join(entry.Winners, ", ")
+		}
+		entries[len(history) - 1 - i] = entry.Ended.UTC().Format("Jan 2 15:04 MST") + onRound(entry.Round) + ": " + strings.Join(entry.Results, ", ") + ", " + winners
+	}
+	lastResults.Unlock()
+	if len(entries) == 0 {
+		respond(message, "No betting round has ended yet.")
+		return
+	}
+	respond(message, "Last round(s): " + strings.Join(entries, " | "))
+}
+
+// Writes the result of the most recently ended round on the channel to a
+// file.
+func betExport(message *twitch.PrivateMessage, args []string) {
+	result := lastResult(message.Channel)
+	if result == nil {
+		respond(message, "There is no ended betting round to export.")
+		return
+	}
+
+	data, err := json.MarshalIndent(result, "", "\t")
+	if err != nil {
+		slog.Error("Failed to encode export", "event", "export", "channel", message.Channel, "error", err)
+		respond(message, "Could not export the results.")
+		return
+	}
+	name := "frammiebot-" + message.Channel + "-" + result.Ended.Format("20060102-150405") + ".json"
+	path := filepath.Join(exportDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		slog.Error("Failed to write export", "event", "export", "channel", message.Channel, "file", path, "error", err)
+		respond(message, "Could not export the results.")
+		return
+	}
+	slog.Info("Exported round", "event", "export", "channel", message.Channel, "file", path)
+	respond(message, "Results exported to " + path)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The longest the sender waits for slow mode to allow a message. Messages
+// that would have to wait longer are dropped, so a single slow channel does
+// not hold up the messages of all others.
+const MAX_SLOW_WAIT = 3 * time.Second
+
+// The modes of a channel restricting who may chat, as told by Twitch.
+type RoomState struct {
+	// The seconds users must wait between messages, zero when off.
+	slow int
+	emoteOnly bool
+	// The minutes users must have followed for, -1 when off.
+	followersOnly int
+	subsOnly bool
+	// Whether the bot is a moderator, VIP or the broadcaster of the channel,
+	// which Twitch exempts from slow and emote-only mode.
+	exempt bool
+}
+
+// The room state per channel.
+var rooms = struct {
+	sync.Mutex
+	states map[string]*RoomState
+}{states: make(map[string]*RoomState)}
+
+// Returns the room state of given channel, creating it if needed. Rooms must
+// be locked by the caller.
+func roomOf(channel string) *RoomState {
+	state, exist := rooms.states[channel]
+	if !exist {
+		state = &RoomState{followersOnly: -1}
+		rooms.states[channel] = state
+	}
+	return state
+}
+
+// Tracks the modes of a channel, which Twitch sends in full on joining and
+// by the mode changed afterwards. Modes are logged, so operators can tell
+// why messages do not show up in chat.
+func onRoomStateMessage(message twitch.RoomStateMessage) {
+	rooms.Lock()
+	state := roomOf(message.Channel)
+	for mode, value := range message.State {
+		switch mode {
+			case "slow":
+				state.slow = value
+			case "emote-only":
+				state.emoteOnly = value > 0
+			case "followers-only":
+				state.followersOnly = value
+			case "subs-only":
+				state.subsOnly = value > 0
+		}
+	}
+	copied := *state
+	rooms.Unlock()
+	slog.Info("Room state", "event", "roomstate", "channel", message.Channel, "slow", copied.slow, "emote_only", copied.emoteOnly, "followers_only", copied.followersOnly, "subs_only", copied.subsOnly, "exempt", copied.exempt)
+}
+
+// Tracks whether the bot is exempt from the modes of a channel, as told by
+// Twitch on joining and after every message sent.
+func onUserStateMessage(message twitch.UserStateMessage) {
+	exempt := hasBadge(&message.User, "broadcaster", "moderator", "vip")
+	rooms.Lock()
+	state := roomOf(message.Channel)
+	changed := state.exempt != exempt
+	state.exempt = exempt
+	rooms.Unlock()
+	if changed {
+		slog.Info("Room exemption changed", "event", "roomstate", "channel", message.Channel, "exempt", exempt)
+	}
+}
+
+// Returns why the bot can not chat on given channel, or the empty string if
+// it can.
+func chatBlocked(channel string) string {
+	rooms.Lock()
+	defer rooms.Unlock()
+	if state, exist := rooms.states[channel]; exist && state.emoteOnly && !state.exempt {
+		return "emote-only"
+	}
+	return ""
+}
+
+// Returns the interval slow mode requires between messages of the bot on
+// given channel, zero if none.
+func slowInterval(channel string) time.Duration {
+	rooms.Lock()
+	defer rooms.Unlock()
+	if state, exist := rooms.states[channel]; exist && !state.exempt {
+		return time.Duration(state.slow) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// The path of the file to persist betting state to.
+const ENV_STATE_FILE = "FRAMMIEBOT_STATE_FILE"
+
+// The state file used when none is configured.
+const DEFAULT_STATE_FILE = "./state.json"
+
+// The on-disk representation of a BettingRound.
+type roundState struct {
+	Closed bool `json:"closed"`
+	Kind string `json:"kind,omitempty"`
+	// The options bet on, for rounds of one of a set of options.
+	Options []string `json:"options,omitempty"`
+	Mode string `json:"mode,omitempty"`
+	Locked bool `json:"locked,omitempty"`
+	TieBreak string `json:"tiebreak,omitempty"`
+	MinParticipants int `json:"min_participants,omitempty"`
+	Grace time.Duration `json:"grace,omitempty"`
+	ClosedAt time.Time `json:"closed_at,omitempty"`
+	Started time.Time `json:"started,omitempty"`
+	// When the round closes automatically, if it is to.
+	CloseAt time.Time `json:"close_at,omitempty"`
+	// The interval at which chat is reminded of the round while open.
+	Reminder time.Duration `json:"reminder,omitempty"`
+	Tolerance int `json:"tolerance,omitempty"`
+	Bets map[string][]string `json:"bets"`
+	// When each user placed their bet.
+	Placed map[string]time.Time `json:"placed,omitempty"`
+	// The points each user wagered on their bet.
+	Wagers map[string]int64 `json:"wagers,omitempty"`
+	// The users who bet during the grace period after closing.
+	Late map[string]bool `json:"late,omitempty"`
+}
+
+// The on-disk representation of all state that should survive a restart.
+type State struct {
+	// The unnamed round per channel.
+	Rounds map[string]roundState `json:"rounds"`
+	// The named rounds per channel by name.
+	NamedRounds map[string]map[string]roundState `json:"named_rounds,omitempty"`
+	Stats map[string]map[string]*UserStats `json:"stats,omitempty"`
+	// Points balances per user per channel.
+	Points map[string]map[string]int64 `json:"points,omitempty"`
+	// The last rounds ended per channel, oldest first.
+	History map[string][]HistoryEntry `json:"history,omitempty"`
+	// Channels on which the coffee response is turned off.
+	CoffeeDisabled map[string]bool `json:"coffee_disabled,omitempty"`
+	// Channels on which subscriptions are not thanked for.
+	SubsDisabled map[string]bool `json:"subs_disabled,omitempty"`
+	// The command prefixes of channels not using the configured prefix.
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+	// The responses of custom commands per channel by name.
+	CustomCommands map[string]map[string]string `json:"custom_commands,omitempty"`
+	// Wins per user per channel, as stored before statistics were kept.
+	Wins map[string]map[string]int `json:"wins,omitempty"`
+}
+
+// Location of the state file, resolved on startup. State is kept in memory
+// only when empty.
+var stateFile = DEFAULT_STATE_FILE
+
+// Serializes saving state, from taking the snapshot to writing it, so the
+// latest snapshot is always written last.
+var stateMutex sync.Mutex
+
+// Writes all betting rounds and statistics to the state file. Must never be called while
+// holding the lock of a BettingRound.
+func saveState() {
+	if stateFile == "" { return }
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	rounds := allRounds()
+	state := State{Rounds: make(map[string]roundState, len(rounds)), NamedRounds: make(map[string]map[string]roundState)}
+	for _, round := range rounds {
+		round.Lock()
+		rs := roundState{Closed: round.closed, Kind: round.kind.name, Options: round.kind.options, Mode: round.mode, Locked: round.locked, TieBreak: round.tieBreak, MinParticipants: round.minParticipants, Grace: round.grace, Reminder: round.reminder, ClosedAt: round.closedAt, Started: round.started, Tolerance: round.tolerance, Bets: make(map[string][]string, len(round.bets)), Placed: make(map[string]time.Time, len(round.bets)), Wagers: make(map[string]int64), Late: make(map[string]bool)}
+		if round.timer != nil {
+			rs.CloseAt = round.started.Add(round.autoClose)
+		}
+		for user, bet := range round.bets {
+			st := make([]string, len(bet.times))
+			for i, t := range bet.times {
+				st[i] = t.String()
+			}
+			rs.Bets[user] = st
+			rs.Placed[user] = bet.placed
+			if bet.wager > 0 {
+				rs.Wagers[user] = bet.wager
+			}
+			if bet.late {
+				rs.Late[user] = true
+			}
+		}
+		round.Unlock()
+		if round.name == "" {
+			state.Rounds[round.channel] = rs
+		} else {
+			if state.NamedRounds[round.channel] == nil {
+				state.NamedRounds[round.channel] = make(map[string]roundState)
+			}
+			state.NamedRounds[round.channel][round.name] = rs
+		}
+	}
+
+	stats.Lock()
+	state.Stats = make(map[string]map[string]*UserStats, len(stats.users))
+	for channel, users := range stats.users {
+		state.Stats[channel] = make(map[string]*UserStats, len(users))
+		for user, s := range users {
+			copied := *s
+			state.Stats[channel][user] = &copied
+		}
+	}
+	stats.Unlock()
+
+	points.Lock()
+	state.Points = make(map[string]map[string]int64, len(points.balances))
+	for channel, users := range points.balances {
+		state.Points[channel] = make(map[string]int64, len(users))
+		for user, balance := range users {
+			state.Points[channel][user] = balance
+		}
+	}
+	points.Unlock()
+
+	lastResults.Lock()
+	state.History = make(map[string][]HistoryEntry, len(lastResults.history))
+	for channel, history := range lastResults.history {
+		state.History[channel] = append([]HistoryEntry(nil), history...)
+	}
+	lastResults.Unlock()
+
+	coffee.Lock()
+	state.CoffeeDisabled = make(map[string]bool, len(coffee.disabled))
+	for channel := range coffee.disabled {
+		state.CoffeeDisabled[channel] = true
+	}
+	coffee.Unlock()
+
+	subs.Lock()
+	state.SubsDisabled = make(map[string]bool, len(subs.disabled))
+	for channel := range subs.disabled {
+		state.SubsDisabled[channel] = true
+	}
+	subs.Unlock()
+
+	prefixes.Lock()
+	state.Prefixes = make(map[string]string, len(prefixes.channels))
+	for channel, prefix := range prefixes.channels {
+		state.Prefixes[channel] = prefix
+	}
+	prefixes.Unlock()
+
+	custom.Lock()
+	state.CustomCommands = make(map[string]map[string]string, len(custom.commands))
+	for channel, named := range custom.commands {
+		state.CustomCommands[channel] = make(map[string]string, len(named))
+		for name, response := range named {
+			state.CustomCommands[channel][name] = response
+		}
+	}
+	custom.Unlock()
+
+	data, err := json.Marshal(&state)
+	if err != nil {
+		slog.Error("Failed to encode state", "event", "state", "error", err)
+		return
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated
+	// state file behind.
+	tmp := stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		slog.Error("Failed to write state", "event", "state", "file", stateFile, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, stateFile); err != nil {
+		slog.Error("Failed to write state", "event", "state", "file", stateFile, "error", err)
+	}
+}
+
+// Restores betting rounds and statistics from the state file. A missing file is not an
+// error; rounds that fail to parse are dropped with a warning.
+func loadState() error {
+	if stateFile == "" { return nil }
+	data, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	stats.Lock()
+	for channel, users := range state.Stats {
+		stats.users[channel] = users
+	}
+	for channel, wins := range state.Wins {
+		for user, n := range wins {
+			statsOf(channel, user).Wins += n
+		}
+	}
+	stats.Unlock()
+
+	points.Lock()
+	for channel, users := range state.Points {
+		points.balances[channel] = users
+	}
+	points.Unlock()
+
+	lastResults.Lock()
+	for channel, history := range state.History {
+		lastResults.history[channel] = history
+	}
+	lastResults.Unlock()
+
+	coffee.Lock()
+	for channel, disabled := range state.CoffeeDisabled {
+		coffee.disabled[channel] = disabled
+	}
+	coffee.Unlock()
+
+	subs.Lock()
+	for channel, disabled := range state.SubsDisabled {
+		subs.disabled[channel] = disabled
+	}
+	subs.Unlock()
+
+	prefixes.Lock()
+	for channel, prefix := range state.Prefixes {
+		setPrefix(channel, prefix)
+	}
+	prefixes.Unlock()
+
+	custom.Lock()
+	for channel, named := range state.CustomCommands {
+		custom.commands[channel] = named
+	}
+	custom.Unlock()
+
+	var restored []*BettingRound
+	channelBets.Lock()
+	for channel, rs := range state.Rounds {
+		if round := restoreRound(channel, "", rs); round != nil {
+			restored = append(restored, round)
+		}
+	}
+	for channel, named := range state.NamedRounds {
+		for name, rs := range named {
+			if round := restoreRound(channel, name, rs); round != nil {
+				restored = append(restored, round)
+			}
+		}
+	}
+	channelBets.Unlock()
+
+	// Rounds are only locked once the rounds mutex is released.
+	for _, round := range restored {
+		round.Lock()
+		round.resume()
+		round.Unlock()
+	}
+	return nil
+}
+
+// Adds the betting round of given name on given channel as stored in the
+// state file to the open rounds, returning it. Rounds that fail to parse are
+// dropped with a warning, returning nil. The caller must hold the
+// channelBets mutex.
+func restoreRound(channel string, name string, rs roundState) *BettingRound {
+	if rs.Mode == "" {
+		rs.Mode = MODE_EXACT
+	}
+	kind := kinds[0]
+	if rs.Kind == OPTION_KIND {
+		kind = optionKind(rs.Options)
+	} else if rs.Kind != "" {
+		if kind = findKind(rs.Kind); kind == nil {
+			slog.Warn("Dropping betting round of unknown kind", "event", "state", "channel", channel, "round", name, "kind", rs.Kind)
+			return nil
+		}
+	}
+	if rs.TieBreak == "" {
+		rs.TieBreak = TIEBREAK_ALL
+	}
+	// Rounds stored before start times were kept expire counting from now.
+	if rs.Started.IsZero() {
+		rs.Started = time.Now()
+	}
+	options := RoundOptions{kind: kind, mode: rs.Mode, locked: rs.Locked, tieBreak: rs.TieBreak, minParticipants: rs.MinParticipants, grace: rs.Grace, reminder: rs.Reminder, tolerance: rs.Tolerance}
+	if !rs.CloseAt.IsZero() {
+		options.autoClose = rs.CloseAt.Sub(rs.Started)
+	}
+	round := &BettingRound{RoundOptions: options, channel: channel, name: name, closed: rs.Closed, closedAt: rs.ClosedAt, started: rs.Started, bets: make(map[string]*Bet, len(rs.Bets))}
+	for user, st := range rs.Bets {
+		times := make([]Guess, len(st))
+		for i, t := range st {
+			pt, err := kind.parse(t)
+			if err != nil {
+				slog.Warn("Dropping corrupt betting round", "event", "state", "channel", channel, "round", name, "error", err)
+				return nil
+			}
+			times[i] = pt
+		}
+		round.bets[user] = &Bet{times: times, placed: rs.Placed[user], late: rs.Late[user], wager: rs.Wagers[user]}
+	}
+	addRound(round)
+	return round
+}
+
+// Resumes the automatic close and reminders of a restored round, closing it
+// right away if it was due while the bot was down. Round must be locked by
+// the caller.
+func (round *BettingRound) resume() {
+	if round.closed { return }
+	if round.autoClose > 0 {
+		round.startAutoClose(time.Until(round.started.Add(round.autoClose)))
+	}
+	round.startReminder()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Every bet saves the state, so the file written last must hold every bet
+// even when bets are placed at once.
+func TestConcurrentSavesKeepLatestState(t *testing.T) {
+	useFakeChat(t)
+	channel := testChannel(t)
+	useStateFile(t)
+	const bettors = 50
+
+	send(channel, "mod", "!bet start", "moderator")
+	var wg sync.WaitGroup
+	for i := 0; i < bettors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			send(channel, "user" + strconv.Itoa(i), "!bet 15:04")
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if saved := len(state.Rounds[channel].Bets); saved != bettors {
+		t.Fatalf("%d bet(s) saved, want %d", saved, bettors)
+	}
+}
+
+// Keeps state in a file of its own for the duration of given test.
+func useStateFile(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	t.Cleanup(func() { stateFile = "" })
+}
+
+// Saves the state, forgets the rounds of given channel, then loads the
+// state again. Returns the restored unnamed round of the channel.
+func restart(t *testing.T, channel string) *BettingRound {
+	t.Helper()
+	saveState()
+	for _, round := range allRounds() {
+		if round.channel == channel {
+			round.Lock()
+			round.stopTimers()
+			round.Unlock()
+		}
+	}
+	channelBets.Lock()
+	delete(channelBets.rounds, channel)
+	channelBets.Unlock()
+	if err := loadState(); err != nil {
+		t.Fatal(err)
+	}
+	round := getRound(channel, "")
+	if round == nil {
+		t.Fatal("the round was not restored")
+	}
+	return round
+}
+
+func TestAutoCloseSurvivesRestart(t *testing.T) {
+	useFakeChat(t)
+	channel := testChannel(t)
+	useStateFile(t)
+
+	send(channel, "mod", "!bet start 1h", "moderator")
+	started := getRound(channel, "")
+	round := restart(t, channel)
+	round.Lock()
+	defer round.Unlock()
+	if round.timer == nil {
+		t.Fatal("the restored round does not close automatically")
+	}
+	if !round.started.Equal(started.started) || round.autoClose != time.Hour {
+		t.Errorf("the restored round closes after %s from %s, want %s from %s", round.autoClose, round.started, time.Hour, started.started)
+	}
+}
+
+// A round due to close while the bot was down closes once restored.
+func TestOverdueAutoCloseAfterRestart(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	useStateFile(t)
+
+	send(channel, "mod", "!bet start 1h", "moderator")
+	send(channel, "viewer", "!bet 15:04")
+	fake.takeSaid()
+	round := getRound(channel, "")
+	round.Lock()
+	round.started = round.started.Add(-2 * time.Hour)
+	round.Unlock()
+
+	restart(t, channel)
+	expectTexts(t, waitSaid(t, fake), "⏰ Time is up, betting has closed! 1 bet(s) locked in. Everyone, good luck!")
+}
+
+// Rounds closed manually or without automatic close stay that way.
+func TestNoAutoCloseAfterRestart(t *testing.T) {
+	useFakeChat(t)
+	channel := testChannel(t)
+	useStateFile(t)
+
+	send(channel, "mod", "!bet start 1h", "moderator")
+	send(channel, "mod", "!bet close", "moderator")
+	round := restart(t, channel)
+	round.Lock()
+	defer round.Unlock()
+	if round.timer != nil {
+		t.Error("a closed round closes automatically once restored")
+	}
+}
+
+func TestReminderSurvivesRestart(t *testing.T) {
+	useFakeChat(t)
+	channel := testChannel(t)
+	useStateFile(t)
+
+	send(channel, "mod", "!bet start reminder=1m", "moderator")
+	round := restart(t, channel)
+	round.Lock()
+	if round.reminder != time.Minute || round.stopReminder == nil {
+		t.Errorf("the restored round reminds every %s (running %v), want every %s", round.reminder, round.stopReminder != nil, time.Minute)
+	}
+	round.Unlock()
+
+	// Closed rounds do not remind once restored.
+	send(channel, "mod", "!bet close", "moderator")
+	round = restart(t, channel)
+	round.Lock()
+	defer round.Unlock()
+	if round.stopReminder != nil {
+		t.Error("a closed round reminds once restored")
+	}
+}
+
+func TestLateBetsSurviveRestart(t *testing.T) {
+	useFakeChat(t)
+	channel := testChannel(t)
+	useStateFile(t)
+
+	send(channel, "mod", "!bet start grace=1m", "moderator")
+	send(channel, "early", "!bet 15:04")
+	send(channel, "mod", "!bet close", "moderator")
+	round := getRound(channel, "")
+	round.Lock()
+	closedAt := round.closedAt
+	round.Unlock()
+	message := chatMessage(channel, "late", "!bet 15:04")
+	message.Time = closedAt.Add(time.Second)
+	onPrivateMessage(message)
+
+	round = restart(t, channel)
+	round.Lock()
+	defer round.Unlock()
+	if bet := round.bets["late"]; bet == nil || !bet.late {
+		t.Errorf("the late bet is restored as %+v", bet)
+	}
+	if bet := round.bets["early"]; bet == nil || bet.late {
+		t.Errorf("the early bet is restored as %+v", bet)
+	}
+}
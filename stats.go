@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The number of users shown on the leaderboard.
+const ENV_LEADERBOARD_SIZE = "FRAMMIEBOT_LEADERBOARD_SIZE"
+
+// The leaderboard size used when none is configured.
+const DEFAULT_LEADERBOARD_SIZE = 5
+
+// The argument confirming the statistics of a channel are to be reset.
+const CONFIRM_ARG = "confirm"
+
+// UserStats are the lifetime betting statistics of a user on a channel.
+type UserStats struct {
+	// Number of bets placed, including changed bets.
+	Bets int `json:"bets"`
+	// Number of ended rounds the user had a bet in.
+	Rounds int `json:"rounds"`
+	// Number of rounds won.
+	Wins int `json:"wins"`
+}
+
+// A LeaderboardEntry is the number of rounds won by a single user.
+type LeaderboardEntry struct {
+	user string
+	wins int
+}
+
+// Statistics per user per channel. Users are keyed by lowercase name so
+// changes in display name casing do not split their statistics.
+var stats = struct {
+	sync.Mutex
+	users map[string]map[string]*UserStats
+}{users: make(map[string]map[string]*UserStats)}
+
+// Configured number of users shown on the leaderboard.
+var leaderboardSize = DEFAULT_LEADERBOARD_SIZE
+
+// Returns the statistics of given user on given channel, creating them if
+// needed. Stats must be locked by the caller.
+func statsOf(channel string, user string) *UserStats {
+	users, exist := stats.users[channel]
+	if !exist {
+		users = make(map[string]*UserStats)
+		stats.users[channel] = users
+	}
+	user = strings.ToLower(user)
+	if users[user] == nil {
+		users[user] = &UserStats{}
+	}
+	return users[user]
+}
+
+// Counts a bet placed by given user on given channel.
+func recordBet(channel string, user string) {
+	stats.Lock()
+	statsOf(channel, user).Bets++
+	stats.Unlock()
+}
+
+// Counts an ended round on given channel for all participating users and
+// the winners among them.
+func recordRound(channel string, participants []string, winners []string) {
+	stats.Lock()
+	defer stats.Unlock()
+	for _, user := range participants {
+		statsOf(channel, user).Rounds++
+	}
+	for _, user := range winners {
+		statsOf(channel, user).Wins++
+	}
+}
+
+// Returns a copy of the statistics of given user on given channel, or false
+// if the user has none.
+func lookupStats(channel string, user string) (UserStats, bool) {
+	stats.Lock()
+	defer stats.Unlock()
+	s, exist := stats.users[channel][strings.ToLower(user)]
+	if !exist { return UserStats{}, false }
+	return *s, true
+}
+
+// Returns the users with the most wins on given channel, ordered by wins
+// and then by name.
+func topWinners(channel string, n int) []LeaderboardEntry {
+	stats.Lock()
+	entries := make([]LeaderboardEntry, 0, len(stats.users[channel]))
+	for user, s := range stats.users[channel] {
+		if s.Wins > 0 {
+			entries = append(entries, LeaderboardEntry{user, s.Wins})
+		}
+	}
+	stats.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].wins != entries[j].wins {
+			return entries[i].wins > entries[j].wins
+		}
+		return entries[i].user < entries[j].user
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Removes the statistics and points of a user on the channel.
+func resetUser(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 1 {
+		respond(message, "Format: resetuser <user>")
+		return
+	}
+	user := strings.TrimPrefix(args[0], "@")
+	stats.Lock()
+	_, hadStats := stats.users[message.Channel][strings.ToLower(user)]
+	delete(stats.users[message.Channel], strings.ToLower(user))
+	stats.Unlock()
+	points.Lock()
+	_, hadPoints := points.balances[message.Channel][strings.ToLower(user)]
+	delete(points.balances[message.Channel], strings.ToLower(user))
+	points.Unlock()
+	if !hadStats && !hadPoints {
+		respond(message, user + " has no stats or points to reset.")
+		return
+	}
+	saveState()
+	audit(AuditEntry{Event: "reset", Channel: message.Channel, User: message.User.DisplayName, Target: user})
+	respond(message, "Reset the stats and points of " + user + ".")
+}
+
+// Removes the statistics and points of all users on the channel, once
+// confirmed by repeating the command with the confirm argument.
+func resetChannel(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 1 || args[0] != CONFIRM_ARG {
+		respond(message, "This removes the stats and points of everyone on " + message.Channel + ". Add " + CONFIRM_ARG + " to reset them anyway.")
+		return
+	}
+	stats.Lock()
+	delete(stats.users, message.Channel)
+	stats.Unlock()
+	points.Lock()
+	delete(points.balances, message.Channel)
+	points.Unlock()
+	saveState()
+	audit(AuditEntry{Event: "reset", Channel: message.Channel, User: message.User.DisplayName})
+	respond(message, "Reset the stats and points of everyone on " + message.Channel + ".")
+}
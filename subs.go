@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The minimum time between two thank-yous for subscriptions on the same
+// channel, so a mass gift of subscriptions does not flood chat.
+const SUB_COOLDOWN = 10 * time.Second
+
+// The channels on which subscriptions are not thanked for. Enabled on all
+// other channels.
+var subs = struct {
+	sync.Mutex
+	disabled map[string]bool
+}{disabled: make(map[string]bool)}
+
+// Whether subscriptions are thanked for on given channel.
+func subsEnabled(channel string) bool {
+	subs.Lock()
+	defer subs.Unlock()
+	return !subs.disabled[channel]
+}
+
+// Turns thanking for subscriptions on given channel on or off.
+func setSubs(channel string, enabled bool) {
+	subs.Lock()
+	if enabled {
+		delete(subs.disabled, channel)
+	} else {
+		subs.disabled[channel] = true
+	}
+	subs.Unlock()
+	saveState()
+}
+
+// Thanks for a subscription, resubscription or gifted subscription.
+func thankSubscriber(message twitch.UserNoticeMessage) {
+	user := message.User.DisplayName
+	var thanks string
+	switch message.MsgID {
+		case "sub":
+			thanks = strings.NewReplacer("{user}", user).Replace(accessibleText(config.SubGreeting))
+		case "resub":
+			months := message.MsgParams["msg-param-cumulative-months"]
+			thanks = strings.NewReplacer("{user}", user, "{months}", months).Replace(accessibleText(config.ResubGreeting))
+		case "subgift", "anonsubgift":
+			recipient := message.MsgParams["msg-param-recipient-display-name"]
+			thanks = strings.NewReplacer("{gifter}", user, "{recipient}", recipient).Replace(accessibleText(config.GiftGreeting))
+	}
+	slog.Info("Subscribed", "event", "sub", "channel", message.Channel, "type", message.MsgID, "user", user)
+	if !subsEnabled(message.Channel) { return }
+	if !checkCooldown(message.Channel, "sub", SUB_COOLDOWN) { return }
+	chat.Say(message.Channel, thanks)
+}
+
+// Turns thanking for subscriptions on the channel on or off.
+func subsCommand(message *twitch.PrivateMessage, args []string) {
+	if len(args) < 1 {
+		respond(message, "Format: subs <on|off>")
+		return
+	}
+	switch args[0] {
+		case "on":
+			setSubs(message.Channel, true)
+			respond(message, "I will thank subscribers again.")
+		case "off":
+			setSubs(message.Channel, false)
+			respond(message, "I will no longer thank subscribers.")
+		default:
+			respond(message, "Format: subs <on|off>")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The interval to validate the OAuth token with Twitch at, such as "1h".
+// The token is not validated when unset.
+const ENV_TOKEN_CHECK_INTERVAL = "FRAMMIEBOT_TOKEN_CHECK_INTERVAL"
+
+// The endpoint of Twitch validating OAuth tokens.
+const TOKEN_VALIDATE_URL = "https://id.twitch.tv/oauth2/validate"
+
+// How long before the token expires to start warning about it.
+const TOKEN_EXPIRY_WARNING = 72 * time.Hour
+
+// The error returned when Twitch reports the token as invalid.
+var errTokenInvalid = errors.New("token is invalid")
+
+// Asks Twitch how long given token remains valid. Tokens that do not expire
+// yield zero.
+func validateToken(token string) (time.Duration, error) {
+	request, err := http.NewRequest(http.MethodGet, TOKEN_VALIDATE_URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Authorization", "OAuth " + token)
+	httpClient := http.Client{Timeout: 10 * time.Second}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized {
+		return 0, errTokenInvalid
+	}
+	if response.StatusCode != http.StatusOK {
+		return 0, errors.New("unexpected status " + strconv.Itoa(response.StatusCode))
+	}
+	var body struct {
+		ExpiresIn int64 `json:"expires_in"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+	return time.Duration(body.ExpiresIn) * time.Second, nil
+}
+
+// Validates given token now and then at given interval, logging an error
+// when it became invalid and a warning when it expires soon.
+func watchToken(token string, interval time.Duration) {
+	for {
+		expiresIn, err := validateToken(token)
+		switch {
+			case err == errTokenInvalid:
+				slog.Error("OAuth token is no longer valid, the bot can not send messages until it restarts with a new token", "event", "token")
+			case err != nil:
+				slog.Warn("Failed to validate OAuth token", "event", "token", "error", err)
+			case expiresIn > 0 && expiresIn < TOKEN_EXPIRY_WARNING:
+				slog.Warn("OAuth token expires soon", "event", "token", "expires_in", expiresIn)
+			default:
+				slog.Debug("OAuth token is valid", "event", "token", "expires_in", expiresIn)
+		}
+		time.Sleep(interval)
+	}
+}
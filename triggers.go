@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"github.com/gempir/go-twitch-irc/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The maximum number of configured triggers.
+const MAX_TRIGGERS = 50
+
+// The longest pattern a trigger may have. Go regular expressions run in time
+// linear in the message, so patterns can not backtrack catastrophically, but
+// long patterns still compile to large programs run on every message.
+const MAX_TRIGGER_PATTERN = 200
+
+// The name of the built-in trigger made up of the water trigger and the
+// coffee response.
+const COFFEE_TRIGGER = "coffee"
+
+// A Trigger is an automatic response to chat messages matching a pattern,
+// such as the coffee response to messages about water.
+type Trigger struct {
+	// Identifies the trigger in logs and metrics. The pattern is used when
+	// empty.
+	Name string `json:"name"`
+	// The regular expression matched against every chat message.
+	Pattern string `json:"pattern"`
+	// Posted when the pattern matches. {user} is replaced by the name of the
+	// sender of the message.
+	Response string `json:"response"`
+	// How long the trigger stays silent on a channel after firing there.
+	// Fires on every match when zero.
+	Cooldown Duration `json:"cooldown"`
+}
+
+// A trigger along with its compiled pattern.
+type compiledTrigger struct {
+	*Trigger
+	regex *regexp.Regexp
+}
+
+// The triggers of the configuration in effect, the built-in coffee trigger
+// first. Replaced along with the configuration.
+var triggers []compiledTrigger
+
+// Returns the triggers of given configuration compiled, starting with the
+// coffee trigger unless its pattern is empty. Names must be unique.
+func compileTriggers(c *Config) ([]compiledTrigger, error) {
+	all := make([]Trigger, 0, len(c.Triggers) + 1)
+	if c.WaterTrigger != "" {
+		all = append(all, Trigger{Name: COFFEE_TRIGGER, Pattern: c.WaterTrigger, Response: c.CoffeeResponse})
+	}
+	all = append(all, c.Triggers...)
+
+	compiled := make([]compiledTrigger, 0, len(all))
+	names := make(map[string]bool)
+	for i := range all {
+		trigger := &all[i]
+		if trigger.Name == "" {
+			trigger.Name = trigger.Pattern
+		}
+		if names[trigger.Name] {
+			return nil, errors.New("trigger " + trigger.Name + " is configured twice")
+		}
+		names[trigger.Name] = true
+		regex, err := compileTriggerPattern(trigger.Pattern)
+		if err != nil {
+			return nil, errors.New("invalid pattern of trigger " + trigger.Name + ": " + err.Error())
+		}
+		if trigger.Response == "" || utf8.RuneCountInString(trigger.Response) > MAX_CUSTOM_RESPONSE {
+			return nil, errors.New("response of trigger " + trigger.Name + " must have 1 to " + strconv.Itoa(MAX_CUSTOM_RESPONSE) + " characters")
+		}
+		if trigger.Cooldown.Duration < 0 {
+			return nil, errors.New("cooldown of trigger " + trigger.Name + " must not be negative")
+		}
+		compiled = append(compiled, compiledTrigger{trigger, regex})
+	}
+	return compiled, nil
+}
+
+// Compiles the pattern of a trigger, rejecting patterns that are too long or
+// match every message.
+func compileTriggerPattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > MAX_TRIGGER_PATTERN {
+		return nil, errors.New("longer than " + strconv.Itoa(MAX_TRIGGER_PATTERN) + " characters")
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if regex.MatchString("") {
+		return nil, errors.New("matches every message")
+	}
+	return regex, nil
+}
+
+// Posts the response of the first trigger matching given message, unless it
+// is on cooldown or, for the coffee trigger, turned off on the channel. At
+// most one trigger fires per message.
+func runTriggers(message *twitch.PrivateMessage) {
+	for _, trigger := range triggers {
+		if trigger.Name == COFFEE_TRIGGER && !coffeeEnabled(message.Channel) { continue }
+		if !trigger.regex.MatchString(message.Message) { continue }
+		if !checkCooldown(message.Channel, "trigger " + trigger.Name, trigger.Cooldown.Duration) { return }
+		if trigger.Name == COFFEE_TRIGGER {
+			coffeeTotal.Inc("")
+		} else {
+			triggersTotal.Inc(trigger.Name)
+		}
+		chat.Say(message.Channel, strings.ReplaceAll(accessibleText(trigger.Response), "{user}", message.User.DisplayName))
+		return
+	}
+}
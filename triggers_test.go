@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWaterTrigger(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+
+	for _, text := range []string{"water", "I need some WATER", "wātēr please"} {
+		send(channel, "viewer", text)
+		said := fake.takeSaid()
+		expectTexts(t, said, COFFEE_RESPONSE)
+		if !utf8.ValidString(said[0]) {
+			t.Errorf("response to %q is not valid UTF-8: %q", text, said[0])
+		}
+	}
+	send(channel, "viewer", "wine")
+	expectTexts(t, fake.takeSaid())
+}
+
+func TestWaterTriggerTurnedOff(t *testing.T) {
+	fake := useFakeChat(t)
+	channel := testChannel(t)
+	setCoffee(channel, false)
+	t.Cleanup(func() { setCoffee(channel, true) })
+
+	send(channel, "viewer", "water")
+	expectTexts(t, fake.takeSaid())
+}
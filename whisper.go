@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Whether given message was whispered to the bot rather than sent in chat.
+// Responses to such messages are whispered back.
+func private(message *twitch.PrivateMessage) bool {
+	return message.Type == twitch.WHISPER
+}
+
+// Handles whispers, allowing users to bet without revealing their bet in
+// chat. Whispers have the form "bet [channel] <value...>", where the channel
+// may be omitted if the bot is in a single channel only.
+func onWhisperMessage(whisper twitch.WhisperMessage) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	user := whisper.User.Name
+	if debugMessages {
+		slog.Debug("Received whisper", "event", "whisper", "user", user, "text", whisper.Message)
+	}
+	parts := regex["message"].FindAllString(strings.TrimPrefix(whisper.Message, config.Prefix), -1)
+	if len(parts) < 2 || parts[0] != "bet" {
+		chat.Whisper(user, "Whisper me \"bet [channel] <value...>\" to bet privately.")
+		return
+	}
+
+	args := parts[1:]
+	var channel string
+	if isJoined(normalizeChannel(args[0])) {
+		channel = normalizeChannel(args[0])
+		args = args[1:]
+	} else if channels := joinedChannels(); len(channels) == 1 {
+		channel = channels[0]
+	} else {
+		chat.Whisper(user, "I am in multiple channels, whisper me \"bet <channel> <value...>\" instead.")
+		return
+	}
+	if len(args) < 1 {
+		chat.Whisper(user, "Whisper me \"bet [channel] <value...>\" to bet privately.")
+		return
+	}
+
+	// Handle the whisper as a bet placed on the channel, which is answered
+	// privately.
+	message := twitch.PrivateMessage{
+		User: whisper.User,
+		Type: twitch.WHISPER,
+		Message: whisper.Message,
+		Channel: channel,
+		Time: time.Now(),
+	}
+	placeBet(&message, args)
+}